@@ -3,6 +3,6 @@ module local/BrowserArtifact
 go 1.18
 
 require (
-	github.com/mattn/go-sqlite3 v1.14.22 // indirect
-	github.com/pierrec/lz4 v2.6.1+incompatible // indirect
+	github.com/mattn/go-sqlite3 v1.14.22
+	github.com/pierrec/lz4 v2.6.1+incompatible
 )
@@ -1,15 +1,18 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	. "local/BrowserArtifact/src"
-	. "local/BrowserArtifact/src/browsers/chromium"
-	. "local/BrowserArtifact/src/browsers/firefox"
+	_ "local/BrowserArtifact/src/browsers/chromium"
+	_ "local/BrowserArtifact/src/browsers/firefox"
 	. "local/BrowserArtifact/src/export"
 	"os"
+	"path/filepath"
 	"runtime"
-	"sort"
+	"strings"
+	"text/tabwriter"
 	"time"
 )
 
@@ -18,6 +21,9 @@ import (
 var OsName string
 var browserArg string
 
+var rootPath string
+var targetOS string
+
 var startDateString string
 var endDateString string
 
@@ -31,166 +37,183 @@ var endDate time.Time
 var profile string
 var verboseLevel string
 var logFile string
+var sqliteAccess string
+var recoverRecords bool
+var listArtifacts bool
+var workers int
+var sortOutput bool
+var sinkBatch int
+var sinkRetries int
+
+// collect subcommand: copy the source files instead of parsing them
+var collectMode bool
 
 func init() {
 	// Define command line arguments
-	flag.StringVar(&browserArg, "browser", "all", "Browser: chromium, chrome, edge, brave, opera, firefox, all")
+	flag.StringVar(&browserArg, "browser", "all", "Browser: "+strings.Join(browserNames(), ", ")+", all")
 	flag.StringVar(&outputDirectory, "output_directory", ".", "Output Directory")
 	flag.StringVar(&fileBaseName, "file_base_name", "BrowserArtifacts", "File Base Name")
-	flag.StringVar(&outputFormat, "format", "json", "Output Format: json, json_line, csv")
+	flag.StringVar(&outputFormat, "format", "json", "Output Formats, comma separated: "+strings.Join(formatNames(), ", "))
 
 	flag.StringVar(&startDateString, "start_date", "2000-01-01", "Start Date")
 	flag.StringVar(&endDateString, "end_date", "now", "End Date")
 	flag.StringVar(&logFile, "log_file", "", "Log File")
 	flag.StringVar(&verboseLevel, "verbose", "info", "Verbose Level: debug, info, warn, error")
+	flag.StringVar(&sqliteAccess, "sqlite_access", "copy", "SQLite access: copy (read a copy with its -wal/-journal), immutable (read-only in place, ignores the WAL)")
+	flag.BoolVar(&recoverRecords, "recover", true, "Recover records from SQLite WAL and rollback journal files, and carve deleted history records")
+
+	flag.StringVar(&SplunkSink.URL, "splunk_url", "", "Splunk HTTP Event Collector URL, e.g. https://splunk:8088 (format splunk_hec)")
+	flag.StringVar(&SplunkSink.Token, "splunk_token", "", "Splunk HTTP Event Collector token")
+	flag.StringVar(&SplunkSink.Index, "splunk_index", "", "Splunk index (default: index of the token)")
+	flag.StringVar(&SplunkType, "splunk_sourcetype", SplunkType, "Splunk sourcetype")
+	flag.StringVar(&ElasticSink.URL, "elastic_url", "", "Elasticsearch URL, e.g. https://elastic:9200 (format elasticsearch)")
+	flag.StringVar(&ElasticSink.Token, "elastic_token", "", "Elasticsearch API key, user and password can be given in the URL instead")
+	flag.StringVar(&ElasticSink.Index, "elastic_index", ElasticSink.Index, "Elasticsearch index or data stream")
+	flag.StringVar(&SyslogSink.URL, "syslog_url", "", "Syslog collector: udp://host:514, tcp://host:514 or tls://host:6514 (formats syslog, cef, leef)")
+	flag.IntVar(&SyslogRate, "syslog_rate", 0, "Syslog messages sent per second, 0 for no limit")
+	flag.StringVar(&SyslogFraming, "syslog_framing", SyslogFraming, "Syslog framing over TCP and TLS: octet (counting) or newline")
+	flag.IntVar(&sinkBatch, "sink_batch", 500, "Events sent per batch to Splunk, Elasticsearch or syslog")
+	flag.IntVar(&sinkRetries, "sink_retries", 5, "Retries of a batch sent to Splunk, Elasticsearch or syslog before spooling")
+	flag.StringVar(&SinkTLS.CAFile, "tls_ca", "", "PEM certificates of the authorities trusted for the remote outputs")
+	flag.StringVar(&SinkTLS.CertFile, "tls_cert", "", "PEM client certificate for the remote outputs")
+	flag.StringVar(&SinkTLS.KeyFile, "tls_key", "", "PEM key of the client certificate")
+	flag.BoolVar(&SinkTLS.Insecure, "tls_insecure", false, "Do not verify the certificate of the remote outputs")
 
 	flag.StringVar(&profile, "profile", "all", "User Profile")
+	flag.BoolVar(&sortOutput, "sort", true, "Sort artifacts by time, spooling to the temporary directory when they do not fit in memory")
+	flag.IntVar(&workers, "workers", runtime.NumCPU(), "Number of extractors and cache files parsed concurrently")
+	flag.BoolVar(&listArtifacts, "list_artifacts", false, "List the browsers and artifact extractors, then exit")
+
+	flag.StringVar(&rootPath, "root", "", "Root of a mounted disk image, triage folder, KAPE or Velociraptor collection, or a zip of them (default: live system)")
+	flag.StringVar(&targetOS, "target_os", "", "Layout of the target system: windows, darwin, linux (default: guessed from -root, host OS)")
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s [collect]:\n", filepath.Base(os.Args[0]))
+		flag.PrintDefaults()
+	}
 
-	flag.Parse()
+	arguments := os.Args[1:]
+	if len(arguments) > 0 && arguments[0] == "collect" {
+		collectMode = true
+		arguments = arguments[1:]
+	}
+	flag.CommandLine.Parse(arguments)
 }
 
 func log(level string, source string, message string) {
 	Log.Log(level, "main", source, message)
 }
 
+func browserNames() []string {
+	var names []string
+	for _, browser := range Browsers() {
+		names = append(names, browser.Name)
+	}
+	return names
+}
+
+// printArtifacts lists the registered browsers and extractors
+func printArtifacts() {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "BROWSER\tFAMILY")
+	for _, browser := range Browsers() {
+		fmt.Fprintf(writer, "%s\t%s\n", browser.Name, browser.Family)
+	}
+	fmt.Fprintln(writer)
+	fmt.Fprintln(writer, "EXTRACTOR\tFAMILY\tARTIFACT TYPE")
+	for _, extractor := range Extractors("") {
+		fmt.Fprintf(writer, "%s\t%s\t%s\n", extractor.Name(), extractor.Browser(), extractor.ArtifactType())
+	}
+	writer.Flush()
+}
+
 func findProfile() []string {
 	var foundProfile []string
-	switch OsName {
-	case "windows":
-		//List directory in C:/Users
-		dir, err := os.ReadDir("C:\\Users")
-		if err != nil {
-			return foundProfile
-		}
-		for _, entry := range dir {
-			if entry.IsDir() {
-				foundProfile = append(foundProfile, entry.Name())
-			}
 
+	//List directory in C:/Users, /Users or /home
+	dir, err := TargetReadDir(UsersDirectory())
+	if err != nil {
+		return foundProfile
+	}
+	for _, entry := range dir {
+		if entry.IsDir() {
+			foundProfile = append(foundProfile, entry.Name())
 		}
-	case "darwin":
-		// Mac
-		dir, err := os.ReadDir("/Users")
-		if err != nil {
-			return foundProfile
-		}
-		for _, entry := range dir {
-			if entry.IsDir() {
-				foundProfile = append(foundProfile, entry.Name())
-			}
-		}
-
-	case "linux":
-		// Linux
-		dir, err := os.ReadDir("/home")
-		if err != nil {
-			return foundProfile
-		}
-		for _, entry := range dir {
-			if entry.IsDir() {
-				foundProfile = append(foundProfile, entry.Name())
-			}
-		}
-
 	}
 
 	return foundProfile
 }
 
-func findInstalledBrowser() []string {
+// findInstalledBrowser lists the registered browsers with a profile for one of the users, in the user data
+// directories of the native, snap and flatpak packages
+func findInstalledBrowser(profiles []string) []string {
 	var foundBrowser []string
 
-	switch OsName {
-	case "windows":
-		//Check if Chrome is installed
-		if _, err := os.Stat("C:\\Program Files\\Google\\Chrome\\Application\\chromium.exe"); err == nil {
-			foundBrowser = append(foundBrowser, "chromium")
-		}
-		//Check if firefox is installed
-		if _, err := os.Stat("C:\\Program Files\\Mozilla firefox\\firefox.exe"); err == nil {
-			foundBrowser = append(foundBrowser, "firefox")
-		}
-	case "darwin":
-		// Mac
-		//Check if Chrome is installed
-		if _, err := os.Stat("/Applications/Google Chrome.app/Contents/MacOS/Google Chrome"); err == nil {
-			foundBrowser = append(foundBrowser, "chromium")
-		}
-		//Check if firefox is installed
-		if _, err := os.Stat("/Applications/firefox.app/Contents/MacOS/firefox"); err == nil {
-			foundBrowser = append(foundBrowser, "firefox")
-		}
-	case "linux":
-		// Linux
-		//Check if Chrome is installed
-		if _, err := os.Stat("/usr/bin/google-chromium"); err == nil {
-			foundBrowser = append(foundBrowser, "chromium")
-		}
-		//Check if firefox is installed
-		if _, err := os.Stat("/usr/bin/firefox"); err == nil {
-			foundBrowser = append(foundBrowser, "firefox")
+	for _, browser := range Browsers() {
+		for _, profile := range profiles {
+			if len(browser.FindProfiles(profile, browser.Name, OsName)) > 0 {
+				foundBrowser = append(foundBrowser, browser.Name)
+				break
+			}
 		}
 	}
 
 	return foundBrowser
 }
 
-func debugTimestamp(artifacts []BrowserArtifact) {
-	// Debug epoch length
-	const epochSec = 1000000000
-
-	// Dictionnary
-	var dict = make(map[string]string)
+// inRange tells if an artifact is between the start and end dates
+func inRange(artifact BrowserArtifact) bool {
+	return !artifact.Time.Before(startDate) && !artifact.Time.After(endDate)
+}
 
-	for _, artifact := range artifacts {
-		value, ok := dict[artifact.ArtifactType]
-		if !ok {
-			if artifact.Timestamp >= epochSec*1000*1000*1000 {
-				if value != "nano" {
-					fmt.Println("WARN: Inconsistent timestamp format for ", artifact.ArtifactType, " new: nano, old: ", value)
-				}
-				dict[artifact.ArtifactType] = "nano"
-			} else if artifact.Timestamp >= epochSec*1000*1000 {
-				if value != "micro" {
-					fmt.Println("WARN: Inconsistent timestamp format for ", artifact.ArtifactType, " new: micro, old: ", value)
-				}
-				dict[artifact.ArtifactType] = "micro"
-			} else if artifact.Timestamp >= epochSec*1000 {
-				if value != "milli" {
-					fmt.Println("WARN: Inconsistent timestamp format for ", artifact.ArtifactType, " new: milli, old: ", value)
-				}
-				dict[artifact.ArtifactType] = "milli"
-			} else {
-				if value != "sec" {
-					fmt.Println("WARN: Inconsistent timestamp format for ", artifact.ArtifactType, " new: sec, old: ", value)
-				}
-				dict[artifact.ArtifactType] = "sec"
-			}
-		}
+func formatNames() []string {
+	var names []string
+	for _, format := range Formats() {
+		names = append(names, format.Name)
 	}
-
-	fmt.Println("Timestamp format: ", dict)
-
+	return names
 }
 
-func FilterArtifacts(artifacts []BrowserArtifact, startDate time.Time, endDate time.Time) []BrowserArtifact {
-	var filteredArtifacts []BrowserArtifact
-	//debugTimestamp(artifacts)
+// output is an output file being exported, a failed output is skipped for the rest of the run
+type output struct {
+	format   Format
+	path     string
+	exporter Exporter
+	err      error
+}
 
-	for _, artifact := range artifacts {
-		// Convert ms to s, ms
-		timestamp_sec := artifact.Timestamp / 1000000
-		timestamp_nano := (artifact.Timestamp % 1000000) * 1000
+// outputFormats returns the formats given to -format
+func outputFormats() []string {
+	var names []string
+	for _, name := range strings.Split(outputFormat, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
 
-		timestamp := time.Unix(int64(timestamp_sec), int64(timestamp_nano))
-		//fmt.Println(artifact.ArtifactType, ": ", artifact.Timestamp, ":", timestamp.Format("2006-01-02"))
+// newOutputs begins an exporter per format, the extension of the format is added when several formats are written
+func newOutputs() []*output {
+	names := outputFormats()
+	var outputs []*output
+	for _, name := range names {
+		format, _ := GetFormat(name)
+		path := filepath.Join(outputDirectory, fileBaseName)
+		if len(names) > 1 || format.Sink {
+			path += format.Extension
+		}
 
-		if timestamp.Unix() >= startDate.Unix() && timestamp.Unix() <= endDate.Unix() {
-			filteredArtifacts = append(filteredArtifacts, artifact)
+		out := &output{format: format, path: path, exporter: format.New()}
+		if format.Sink {
+			log("info", "main", "Sending to "+name+", spooling to "+path+" when unreachable")
+		} else {
+			log("info", "main", "Exporting to "+path+" in "+name+" format")
 		}
+		out.err = out.exporter.Begin(path)
+		outputs = append(outputs, out)
 	}
-
-	return filteredArtifacts
+	return outputs
 }
 
 func argVerify() bool {
@@ -201,8 +224,49 @@ func argVerify() bool {
 		isValid = false
 	}
 
-	if outputFormat != "json" && outputFormat != "json_line" && outputFormat != "csv" {
-		fmt.Println("Invalid output format: ", outputFormat)
+	if _, ok := GetBrowser(browserArg); !ok && browserArg != "all" {
+		fmt.Println("Invalid browser: ", browserArg)
+		isValid = false
+	}
+
+	if len(outputFormats()) == 0 {
+		fmt.Println("No output format given")
+		isValid = false
+	}
+	for _, name := range outputFormats() {
+		if _, ok := GetFormat(name); !ok {
+			fmt.Println("Invalid output format: ", name)
+			isValid = false
+		}
+	}
+
+	if workers < 1 {
+		fmt.Println("Invalid number of workers: ", workers)
+		isValid = false
+	}
+
+	if SyslogRate < 0 {
+		fmt.Println("Invalid syslog rate: ", SyslogRate)
+		isValid = false
+	}
+
+	if sinkBatch < 1 || sinkRetries < 0 {
+		fmt.Println("Invalid sink batch size or retries: ", sinkBatch, sinkRetries)
+		isValid = false
+	}
+
+	if sqliteAccess != "copy" && sqliteAccess != "immutable" {
+		fmt.Println("Invalid SQLite access mode: ", sqliteAccess)
+		isValid = false
+	}
+
+	if targetOS != "" && targetOS != "windows" && targetOS != "darwin" && targetOS != "linux" {
+		fmt.Println("Invalid target OS: ", targetOS)
+		isValid = false
+	}
+
+	if rootPath != "" && !CheckPath(rootPath, false) {
+		fmt.Println("Root directory or zip not found: ", rootPath)
 		isValid = false
 	}
 
@@ -226,12 +290,74 @@ func argVerify() bool {
 	return isValid
 }
 
+// setRunMetadata describes the run for the output formats holding metadata
+func setRunMetadata(jobs []Job) {
+	arguments, _ := json.Marshal(os.Args[1:])
+	hostname, _ := os.Hostname()
+	RunMetadata["version"] = Version
+	RunMetadata["arguments"] = string(arguments)
+	RunMetadata["hostname"] = hostname
+	RunMetadata["started"] = FormatTime(time.Now())
+	RunMetadata["root"] = RootPath
+	RunMetadata["target_os"] = OsName
+	RunMetadata["start_date"] = FormatTime(startDate)
+	RunMetadata["end_date"] = FormatTime(endDate)
+	RunMetadata["jobs"] = fmt.Sprint(len(jobs))
+}
+
+// collect copies the source files of the jobs and the profile lists of the browsers into a zip
+func collect(profiles []string, browsers []string, jobs []Job) {
+	path := filepath.Join(outputDirectory, fileBaseName+".zip")
+	log("info", "collect", "Collecting to "+path)
+	collection, err := NewCollection(path)
+	if err != nil {
+		log("error", "collect", "Failed to create "+path+": "+err.Error())
+		os.Exit(1)
+	}
+
+	var sources []string
+	for _, profile := range profiles {
+		for _, name := range browsers {
+			if browser, _ := GetBrowser(name); browser.Files != nil {
+				sources = append(sources, browser.Files(profile, name, OsName)...)
+			}
+		}
+	}
+	for _, job := range jobs {
+		sources = append(sources, job.Extractor.Sources(job.Profile)...)
+	}
+	for _, source := range sources {
+		if err = collection.Add(source); err != nil {
+			break
+		}
+	}
+	if closeErr := collection.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log("error", "collect", "Failed to write "+path+": "+err.Error())
+		os.Exit(1)
+	}
+
+	log("info", "collect", fmt.Sprintf("Collected %d files, %d failed", len(collection.Files)-collection.Failed(), collection.Failed()))
+	log("info", "collect", "SHA-256 of "+path+": "+collection.SHA256)
+	if collection.Failed() > 0 {
+		os.Exit(1)
+	}
+	log("info", "collect", "Collection completed")
+}
+
 // Main function
 func main() {
-	if !argVerify() {
+	if listArtifacts {
+		printArtifacts()
 		return
 	}
 
+	if !argVerify() {
+		os.Exit(2)
+	}
+
 	// Set log level
 	Log.SetLevel(verboseLevel)
 
@@ -240,15 +366,28 @@ func main() {
 		file, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 		if err != nil {
 			fmt.Println("Failed to open log file: ", logFile)
-			return
+			os.Exit(1)
 		}
 		Log.SetOutput(file)
 	} else {
 		Log.SetOutput(os.Stdout)
 	}
 
-	OsName = runtime.GOOS
+	if err := SetTarget(rootPath, targetOS); err != nil {
+		log("error", "main", "Failed to read root: "+err.Error())
+		os.Exit(2)
+	}
+	SQLiteAccess = sqliteAccess
+	RecoverRecords = recoverRecords
+	Workers = workers
+	SplunkSink.BatchSize, SplunkSink.Retries = sinkBatch, sinkRetries
+	ElasticSink.BatchSize, ElasticSink.Retries = sinkBatch, sinkRetries
+	SyslogSink.BatchSize, SyslogSink.Retries = sinkBatch, sinkRetries
+	OsName = TargetOS
 	log("info", "main", "OS: "+OsName)
+	if RootPath != "" {
+		log("info", "main", "Root: "+RootPath)
+	}
 
 	// Parse Date String
 	if endDateString == "now" {
@@ -271,62 +410,122 @@ func main() {
 
 	var browsers []string
 	if browserArg == "all" {
-		browsers = findInstalledBrowser()
+		browsers = findInstalledBrowser(profiles)
 	} else {
 		browsers = append(browsers, browserArg)
 	}
 
 	log("info", "main", "Browsers: "+fmt.Sprint(browsers))
 
-	var artifacts []BrowserArtifact
+	var jobs []Job
 
 	// Loop through profiles
 	for _, profile := range profiles {
-		for _, browser := range browsers {
-			switch browser {
-			case "chrome":
-				log("debug", "main", "Processing Chromium artifacts for profile: "+profile)
-				artifacts = append(artifacts, GetChromeArtifacts(profile, browser, OsName)...)
-			case "chromium":
-				log("debug", "main", "Processing Chrome artifacts for profile: "+profile)
-				artifacts = append(artifacts, GetChromeArtifacts(profile, browser, OsName)...)
-			case "edge":
-				log("debug", "main", "Processing Edge artifacts for profile: "+profile)
-				artifacts = append(artifacts, GetChromeArtifacts(profile, browser, OsName)...)
-			case "brave":
-				log("debug", "main", "Processing Brave artifacts for profile: "+profile)
-				artifacts = append(artifacts, GetChromeArtifacts(profile, browser, OsName)...)
-			case "opera":
-				log("debug", "main", "Processing Opera artifacts for profile: "+profile)
-				artifacts = append(artifacts, GetChromeArtifacts(profile, browser, OsName)...)
-			case "firefox":
-				log("debug", "main", "Processing firefox artifacts for profile: "+profile)
-				artifacts = append(artifacts, GetFirefoxArtifacts(profile, OsName)...)
+		for _, name := range browsers {
+			browser, _ := GetBrowser(name)
+			log("debug", "main", "Processing "+name+" artifacts for profile: "+profile)
+			for _, browserProfile := range browser.FindProfiles(profile, name, OsName) {
+				log("debug", "main", fmt.Sprintf("Processing profile %s (%s) in %s", browserProfile.Directory, browserProfile.Name, browserProfile.Path))
+				for _, extractor := range Extractors(browser.Family) {
+					jobs = append(jobs, Job{Extractor: extractor, Profile: browserProfile})
+				}
 			}
 		}
 	}
 
-	log("info", "main", "Total Artifacts: "+fmt.Sprint(len(artifacts)))
-	filteredArtifacts := FilterArtifacts(artifacts, startDate, endDate)
-	log("info", "main", "Filtered Artifacts: "+fmt.Sprint(len(filteredArtifacts)))
+	if collectMode {
+		collect(profiles, browsers, jobs)
+		return
+	}
+
+	setRunMetadata(jobs)
+	outputs := newOutputs()
+	begun := 0
+	for _, out := range outputs {
+		if out.err == nil {
+			begun++
+		}
+	}
+	if begun == 0 {
+		for _, out := range outputs {
+			log("error", "main", "Export to "+out.path+" failed: "+out.err.Error())
+		}
+		os.Exit(1)
+	}
+
+	// Artifacts go from the extractors to the exporters, through the sorter if sorted output is requested
+	var sorter *Sorter
+	if sortOutput {
+		var err error
+		if sorter, err = NewSorter(); err != nil {
+			log("error", "main", "Failed to create sort directory: "+err.Error())
+			os.Exit(1)
+		}
+	}
 
-	fmt.Println("Sorting artifacts...")
-	//Sorting Artifacts by timestamp
-	sort.Slice(filteredArtifacts[:], func(i, j int) bool {
-		return filteredArtifacts[i].Timestamp < filteredArtifacts[j].Timestamp
+	var total, filtered int
+	var sortError error
+	write := func(artifact BrowserArtifact) {
+		for _, out := range outputs {
+			if out.err != nil {
+				continue
+			}
+			out.err = out.exporter.Write(artifact)
+		}
+	}
+
+	log("info", "main", fmt.Sprintf("Running %d extractors on %d workers", len(jobs), Workers))
+	StreamJobs(jobs, func(artifact BrowserArtifact) {
+		total++
+		if !inRange(artifact) {
+			return
+		}
+		filtered++
+		if sorter == nil {
+			write(artifact)
+		} else if sortError == nil {
+			sortError = sorter.Add(artifact)
+		}
 	})
+	log("info", "main", "Total Artifacts: "+fmt.Sprint(total))
+	log("info", "main", "Filtered Artifacts: "+fmt.Sprint(filtered))
+	RunMetadata["artifacts_total"] = fmt.Sprint(total)
+	RunMetadata["artifacts_exported"] = fmt.Sprint(filtered)
+	RunMetadata["finished"] = FormatTime(time.Now())
+
+	// Evidence altered while it was read (live browser, mounted image written to) must not go unnoticed
+	changed := RecordEvidenceHashes()
+	if len(changed) > 0 {
+		log("error", "main", fmt.Sprintf("%d evidence files changed while they were read, see evidence_changed in the run metadata:", len(changed)))
+		for _, file := range changed {
+			log("error", "main", "Changed: "+file)
+		}
+	}
 
-	// Join output directory and file base name
-	outputFile := outputDirectory + "/" + fileBaseName
-	log("info", "main", "Exporting to "+outputFile+" in "+outputFormat+" format")
-	// Export artifacts to JSON
-	switch outputFormat {
-	case "json":
-		ExportJSON(outputFile, filteredArtifacts)
-	case "json_line":
-		ExportJSONLine(outputFile, filteredArtifacts)
-	case "csv":
-		ExportCSV(outputFile, filteredArtifacts)
+	if sorter != nil {
+		if sortError == nil {
+			fmt.Println("Sorting artifacts...")
+			//Sorting Artifacts by timestamp, equal times keep the order of the jobs
+			sortError = sorter.Sort(write)
+		}
+		sorter.Close()
+		if sortError != nil {
+			log("error", "main", "Failed to sort artifacts: "+sortError.Error())
+		}
+	}
+
+	failed := sortError != nil
+	for _, out := range outputs {
+		if out.err == nil {
+			out.err = out.exporter.End()
+		}
+		if out.err != nil {
+			log("error", "main", "Export to "+out.path+" failed: "+out.err.Error())
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
 	}
 	log("info", "main", "Export completed")
 }
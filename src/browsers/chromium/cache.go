@@ -0,0 +1,379 @@
+package chromium
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	. "local/BrowserArtifact/src"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+/*
+Chromium keeps its HTTP cache in one of two formats:
+  - Simple Cache (Linux, macOS, Android): one <hash>_0 file per entry holding the key, the body and the response headers
+  - Blockfile (Windows): an index file pointing to entries stored in data_0..data_3 block files and f_XXXXXX external files
+
+In both formats, stream 0 of an entry is the pickled HttpResponseInfo (request/response times and raw headers).
+*/
+
+func init() {
+	registerStream("cache", "cache", func(profile Profile) []string {
+		return []string{profile.CachePath}
+	}, processCache)
+}
+
+const (
+	simpleInitialMagic = 0xfcfb6d1ba7725c30
+	simpleFinalMagic   = 0xf4fa6f45970d41d8
+	simpleHeaderSize   = 24
+	simpleEOFSize      = 24
+	simpleHasKeySHA256 = 2
+
+	blockfileIndexMagic  = 0xc103cac3
+	blockfileIndexHeader = 368
+	blockfileFileHeader  = 8192
+	blockfileEntrySize   = 256
+)
+
+// Times are WebKit microseconds
+type cacheEntry struct {
+	key          string
+	creationTime int
+	responseInfo []byte
+}
+
+type responseInfo struct {
+	requestTime  int
+	responseTime int
+	status       string
+	headers      map[string]string
+}
+
+// getCacheRoot returns the directory mirroring userData where the disk caches are kept:
+// ~/.cache on Linux, ~/Library/Caches on macOS, AppData\Local on Windows
+func getCacheRoot(profile string, userData string, osName string) string {
+	home := UserHome(profile)
+	relative, err := filepath.Rel(home, userData)
+	if err != nil {
+		return userData
+	}
+	parts := strings.Split(relative, string(filepath.Separator))
+
+	for i, part := range parts {
+		switch {
+		case osName == "windows" && part == "Roaming":
+			parts[i] = "Local"
+		case osName == "darwin" && part == "Application Support":
+			parts[i] = "Caches"
+		case osName == "linux" && part == ".config":
+			parts[i] = ".cache"
+		case osName == "linux" && part == "config" && parts[0] == ".var":
+			parts[i] = "cache"
+		case osName == "linux" && part == "common" && parts[0] == "snap":
+			parts = append(parts[:i+1], append([]string{".cache"}, parts[i+1:]...)...)
+		default:
+			continue
+		}
+		return filepath.Join(append([]string{home}, parts...)...)
+	}
+
+	return userData
+}
+
+func processCache(path string, emit Emit) {
+	if !CheckPath(path, true) {
+		log("error", "cache", "Directory not found : "+path)
+		return
+	}
+
+	// Since the network service, the cache lives in Cache/Cache_Data
+	if CheckPath(filepath.Join(path, "Cache_Data"), true) {
+		path = filepath.Join(path, "Cache_Data")
+	}
+
+	count := 0
+	add := func(entry cacheEntry) {
+		emit(cacheArtifact(entry))
+		count++
+	}
+
+	var err error
+	if CheckPath(filepath.Join(path, "data_1"), false) {
+		var entries []cacheEntry
+		entries, err = parseBlockfileCache(path)
+		for _, entry := range entries {
+			add(entry)
+		}
+	} else {
+		err = parseSimpleCache(path, add)
+	}
+	if err != nil {
+		log("error", "cache", "Error parsing cache: "+err.Error())
+		return
+	}
+
+	log("info", "cache", fmt.Sprintf("Found %d cache entries in %s", count, path))
+}
+
+func cacheArtifact(entry cacheEntry) BrowserArtifact {
+	artifact := BrowserArtifact{}
+	artifact.ArtifactType = "cache"
+	artifact.Url = cacheKeyURL(entry.key)
+	artifact.TimestampType = "creationTime"
+	artifact.SetTimestamp(int64(entry.creationTime), EpochWebKit)
+
+	info, err := parseResponseInfo(entry.responseInfo)
+	if err != nil {
+		log("debug", "cache", "Error parsing response info of "+entry.key+": "+err.Error())
+	} else {
+		artifact.TimestampType = "responseTime"
+		artifact.SetTimestamp(int64(info.responseTime), EpochWebKit)
+		artifact.Status = info.status
+		artifact.HttpContentType = info.headers["content-type"]
+		artifact.HttpServer = info.headers["server"]
+		artifact.BytesIn, _ = strconv.Atoi(info.headers["content-length"])
+	}
+	return artifact
+}
+
+// cacheKeyURL extracts the resource URL from a cache key
+// e.g. "1/0/_dk_https://a.com https://a.com https://a.com/script.js"
+func cacheKeyURL(key string) string {
+	fields := strings.Fields(key)
+	if len(fields) == 0 {
+		return key
+	}
+	return strings.TrimPrefix(fields[len(fields)-1], "_dk_")
+}
+
+// parseSimpleCache calls add for every entry of the cache, one file at a time
+func parseSimpleCache(path string, add func(entry cacheEntry)) error {
+	dir, err := TargetReadDir(path)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range dir {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), "_0") {
+			continue
+		}
+		entry, err := parseSimpleCacheEntry(filepath.Join(path, file.Name()))
+		if err != nil {
+			log("debug", "cache", "Error parsing cache file "+file.Name()+": "+err.Error())
+			continue
+		}
+		add(entry)
+	}
+	return nil
+}
+
+func parseSimpleCacheEntry(path string) (cacheEntry, error) {
+	entry := cacheEntry{}
+
+	data, err := TargetReadFile(path)
+	if err != nil {
+		return entry, err
+	}
+	if len(data) < simpleHeaderSize+simpleEOFSize || binary.LittleEndian.Uint64(data[0:8]) != simpleInitialMagic {
+		return entry, errors.New("not a simple cache entry")
+	}
+
+	keyLength := int(binary.LittleEndian.Uint32(data[12:16]))
+	if simpleHeaderSize+keyLength > len(data) {
+		return entry, errors.New("invalid key length")
+	}
+	entry.key = string(data[simpleHeaderSize : simpleHeaderSize+keyLength])
+
+	// The last EOF record describes stream 0, stored right before it
+	eof := data[len(data)-simpleEOFSize:]
+	if binary.LittleEndian.Uint64(eof[0:8]) != simpleFinalMagic {
+		return entry, errors.New("invalid EOF record")
+	}
+	flags := binary.LittleEndian.Uint32(eof[8:12])
+	streamSize := int(binary.LittleEndian.Uint32(eof[16:20]))
+
+	streamEnd := len(data) - simpleEOFSize
+	if flags&simpleHasKeySHA256 != 0 {
+		streamEnd -= 32
+	}
+	streamStart := streamEnd - streamSize
+	if streamStart < simpleHeaderSize+keyLength {
+		return entry, errors.New("invalid stream 0 size")
+	}
+	entry.responseInfo = data[streamStart:streamEnd]
+
+	return entry, nil
+}
+
+type blockfileReader struct {
+	path  string
+	files map[string][]byte
+}
+
+func (r *blockfileReader) file(name string) ([]byte, error) {
+	if data, ok := r.files[name]; ok {
+		return data, nil
+	}
+	data, err := TargetReadFile(filepath.Join(r.path, name))
+	if err != nil {
+		return nil, err
+	}
+	r.files[name] = data
+	return data, nil
+}
+
+// read returns the data stored at a cache address
+func (r *blockfileReader) read(addr uint32, size int) ([]byte, error) {
+	if addr&0x80000000 == 0 {
+		return nil, errors.New("address not initialized")
+	}
+
+	fileType := (addr >> 28) & 0x7
+	if fileType == 0 {
+		// External file f_XXXXXX
+		data, err := r.file(fmt.Sprintf("f_%06x", addr&0x0fffffff))
+		if err != nil {
+			return nil, err
+		}
+		if size > len(data) {
+			size = len(data)
+		}
+		return data[:size], nil
+	}
+
+	// Block sizes by file type: rankings, then the 256 B, 1 KB and 4 KB blocks
+	blockSizes := map[uint32]int{1: 36, 2: 256, 3: 1024, 4: 4096}
+	blockSize, ok := blockSizes[fileType]
+	if !ok {
+		return nil, fmt.Errorf("unknown file type %d", fileType)
+	}
+	numBlocks := int((addr>>24)&0x3) + 1
+	fileNumber := (addr >> 16) & 0xff
+	start := blockfileFileHeader + int(addr&0xffff)*blockSize
+
+	data, err := r.file(fmt.Sprintf("data_%d", fileNumber))
+	if err != nil {
+		return nil, err
+	}
+	if size > numBlocks*blockSize {
+		size = numBlocks * blockSize
+	}
+	if start+size > len(data) {
+		return nil, errors.New("address out of bounds")
+	}
+	return data[start : start+size], nil
+}
+
+func parseBlockfileCache(path string) ([]cacheEntry, error) {
+	reader := &blockfileReader{path: path, files: map[string][]byte{}}
+
+	index, err := reader.file("index")
+	if err != nil {
+		return nil, err
+	}
+	if len(index) < blockfileIndexHeader || binary.LittleEndian.Uint32(index[0:4]) != blockfileIndexMagic {
+		return nil, errors.New("not a blockfile cache index")
+	}
+	tableLength := int(binary.LittleEndian.Uint32(index[28:32]))
+	if tableLength == 0 {
+		tableLength = 0x10000
+	}
+
+	entries := []cacheEntry{}
+	visited := map[uint32]bool{}
+	for i := 0; i < tableLength; i++ {
+		offset := blockfileIndexHeader + i*4
+		if offset+4 > len(index) {
+			break
+		}
+
+		// Entries sharing the same hash bucket are chained through their next field
+		addr := binary.LittleEndian.Uint32(index[offset : offset+4])
+		for addr != 0 && !visited[addr] {
+			visited[addr] = true
+			store, err := reader.read(addr, blockfileEntrySize)
+			if err != nil || len(store) < blockfileEntrySize {
+				log("debug", "cache", fmt.Sprintf("Error reading entry at %08x", addr))
+				break
+			}
+			entries = append(entries, parseEntryStore(reader, store))
+			addr = binary.LittleEndian.Uint32(store[4:8])
+		}
+	}
+
+	return entries, nil
+}
+
+func parseEntryStore(reader *blockfileReader, store []byte) cacheEntry {
+	entry := cacheEntry{}
+	entry.creationTime = int(binary.LittleEndian.Uint64(store[24:32]))
+
+	keyLength := int(binary.LittleEndian.Uint32(store[32:36]))
+	longKey := binary.LittleEndian.Uint32(store[36:40])
+	if longKey != 0 {
+		key, err := reader.read(longKey, keyLength)
+		if err == nil {
+			entry.key = string(key)
+		}
+	} else if keyLength <= blockfileEntrySize-96 {
+		entry.key = string(store[96 : 96+keyLength])
+	}
+	entry.key = strings.TrimRight(entry.key, "\x00")
+
+	// Stream 0 holds the response info
+	streamSize := int(binary.LittleEndian.Uint32(store[40:44]))
+	streamAddr := binary.LittleEndian.Uint32(store[56:60])
+	if streamAddr != 0 && streamSize > 0 {
+		entry.responseInfo, _ = reader.read(streamAddr, streamSize)
+	}
+
+	return entry
+}
+
+// parseResponseInfo decodes a pickled HttpResponseInfo:
+// payload size, flags, (extra flags), request time, response time, ..., raw headers string
+func parseResponseInfo(data []byte) (responseInfo, error) {
+	info := responseInfo{headers: map[string]string{}}
+	if len(data) < 24 {
+		return info, errors.New("response info too short")
+	}
+	payload := data[4:]
+
+	// Times are 64-bit microseconds since 1601, right after the flags (and the optional extra flags)
+	offset := 4
+	if !IsWebKitTime(int64(binary.LittleEndian.Uint64(payload[offset:]))) {
+		offset = 8
+	}
+	if len(payload) < offset+16 {
+		return info, errors.New("response info too short")
+	}
+	info.requestTime = int(binary.LittleEndian.Uint64(payload[offset:]))
+	info.responseTime = int(binary.LittleEndian.Uint64(payload[offset+8:]))
+
+	// Raw headers are a length-prefixed string of NUL-separated lines, starting with the status line
+	start := bytes.Index(payload, []byte("HTTP/"))
+	if start < 4 {
+		return info, errors.New("headers not found")
+	}
+	length := int(binary.LittleEndian.Uint32(payload[start-4 : start]))
+	if start+length > len(payload) || length <= 0 {
+		length = len(payload) - start
+	}
+
+	lines := strings.Split(string(payload[start:start+length]), "\x00")
+	statusLine := strings.Fields(lines[0])
+	if len(statusLine) > 1 {
+		info.status = statusLine[1]
+	}
+	for _, line := range lines[1:] {
+		name, value, found := strings.Cut(line, ":")
+		if found {
+			info.headers[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(value)
+		}
+	}
+
+	return info, nil
+}
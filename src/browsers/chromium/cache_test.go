@@ -0,0 +1,124 @@
+package chromium
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	testRequestTime  = 13340000000000000
+	testResponseTime = 13340000001000000
+)
+
+// blockAddr returns the address of a block in data_1 (file type 2, 256 B blocks)
+func blockAddr(numBlocks uint32, block uint32) uint32 {
+	return 0x80000000 | 2<<28 | (numBlocks-1)<<24 | 1<<16 | block
+}
+
+func testResponseInfo(status string, contentType string) []byte {
+	headers := []byte("HTTP/1.1 " + status + "\x00Content-Type: " + contentType + "\x00\x00")
+	data := make([]byte, 28+len(headers))
+	binary.LittleEndian.PutUint64(data[8:], testRequestTime)
+	binary.LittleEndian.PutUint64(data[16:], testResponseTime)
+	binary.LittleEndian.PutUint32(data[24:], uint32(len(headers)))
+	copy(data[28:], headers)
+	binary.LittleEndian.PutUint32(data[0:], uint32(len(data)-4))
+	return data
+}
+
+// writeBlockfileCache writes an index with two buckets, the first one chaining two entries, and a data_1 holding
+// the entries and their response info
+func writeBlockfileCache(t *testing.T, dir string) {
+	t.Helper()
+
+	type entry struct {
+		block   uint32
+		next    uint32
+		key     string
+		created uint64
+		info    []byte
+	}
+	entries := []entry{
+		{block: 1, next: blockAddr(1, 3), key: "1/0/_dk_https://a.com https://a.com https://a.com/script.js", created: testRequestTime, info: testResponseInfo("200 OK", "text/javascript")},
+		{block: 3, key: "https://b.com/logo.png", created: testRequestTime + 1, info: testResponseInfo("404 Not Found", "image/png")},
+		{block: 5, key: "https://c.com/", created: testRequestTime + 2, info: testResponseInfo("301 Moved Permanently", "text/html")},
+	}
+
+	data := make([]byte, blockfileFileHeader+10*256)
+	for _, e := range entries {
+		store := data[blockfileFileHeader+int(e.block)*256:]
+		binary.LittleEndian.PutUint32(store[4:], e.next)
+		binary.LittleEndian.PutUint64(store[24:], e.created)
+		binary.LittleEndian.PutUint32(store[32:], uint32(len(e.key)))
+		binary.LittleEndian.PutUint32(store[40:], uint32(len(e.info)))
+		binary.LittleEndian.PutUint32(store[56:], blockAddr(1, e.block+1))
+		copy(store[96:], e.key)
+		copy(data[blockfileFileHeader+int(e.block+1)*256:], e.info)
+	}
+
+	index := make([]byte, blockfileIndexHeader+4*4)
+	binary.LittleEndian.PutUint32(index[0:], blockfileIndexMagic)
+	binary.LittleEndian.PutUint32(index[28:], 4)
+	binary.LittleEndian.PutUint32(index[blockfileIndexHeader+4:], blockAddr(1, entries[0].block))
+	binary.LittleEndian.PutUint32(index[blockfileIndexHeader+12:], blockAddr(1, entries[2].block))
+
+	for name, content := range map[string][]byte{"index": index, "data_1": data} {
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestParseBlockfileCache(t *testing.T) {
+	dir := t.TempDir()
+	writeBlockfileCache(t, dir)
+
+	entries, err := parseBlockfileCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		url         string
+		created     int
+		status      string
+		contentType string
+	}{
+		{"https://a.com/script.js", testRequestTime, "200", "text/javascript"},
+		{"https://b.com/logo.png", testRequestTime + 1, "404", "image/png"},
+		{"https://c.com/", testRequestTime + 2, "301", "text/html"},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("got %d entries, expected %d", len(entries), len(expected))
+	}
+	for i, e := range expected {
+		entry := entries[i]
+		if url := cacheKeyURL(entry.key); url != e.url {
+			t.Errorf("entry %d: url %q, expected %q", i, url, e.url)
+		}
+		if entry.creationTime != e.created {
+			t.Errorf("entry %d: creation time %d, expected %d", i, entry.creationTime, e.created)
+		}
+
+		info, err := parseResponseInfo(entry.responseInfo)
+		if err != nil {
+			t.Errorf("entry %d: %v", i, err)
+			continue
+		}
+		if info.status != e.status || info.headers["content-type"] != e.contentType {
+			t.Errorf("entry %d: status %q content type %q, expected %q %q", i, info.status, info.headers["content-type"], e.status, e.contentType)
+		}
+		if info.requestTime != testRequestTime || info.responseTime != testResponseTime {
+			t.Errorf("entry %d: times %d %d", i, info.requestTime, info.responseTime)
+		}
+	}
+}
+
+func TestBlockfileReaderRejectsUnknownFileType(t *testing.T) {
+	reader := &blockfileReader{path: t.TempDir(), files: map[string][]byte{}}
+	if _, err := reader.read(0x80000000|5<<28|1<<16, 256); err == nil {
+		t.Error("expected an error for the block file type 5")
+	}
+}
@@ -1,88 +1,229 @@
 package chromium
 
 import (
-	"database/sql"
 	"encoding/json"
 	"fmt"
 	. "local/BrowserArtifact/src"
-	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
-	"time"
+	"strings"
 )
 
 func log(level string, source string, message string) {
 	Log.Log(level, "chromium", source, message)
 }
 
-func getBasePath(profile string, browser string, osName string) []string {
+func init() {
+	for _, name := range []string{"chrome", "chromium", "edge", "brave", "opera", "vivaldi"} {
+		RegisterBrowser(Browser{Name: name, Family: "chromium", FindProfiles: findProfiles, Files: profileListFiles})
+	}
+
+	register("history", "chrome_history", profileFile("History"), processHistory)
+	register("downloads", "download", profileFile("History"), processDownloads)
+	register("bookmarks", "bookmark", profileFile("Bookmarks"), processBookmarks)
+	registerStream("cookies", "cookie", profileFile("Network", "Cookies"), processCookies)
+	register("formhistory", "formhistory, autofill_profile", profileFile("Web Data"), processFormHistory)
+	register("logins", "login", profileFile("Login Data"), processLoginData)
+	register("extensions", "extension", profileFile("Extensions"), processExtensions)
+	register("favicons", "favicon", profileFile("Favicons"), processFavicons)
+}
+
+func register(name string, types string, locate func(profile Profile) []string, extract func(path string) []BrowserArtifact) {
+	RegisterExtractor(FileExtractor{ExtractorName: "chromium_" + name, Family: "chromium", Types: types, LocateFunc: locate, ExtractFunc: extract})
+}
+
+// registerStream registers an extractor emitting its artifacts as they are parsed
+func registerStream(name string, types string, locate func(profile Profile) []string, stream func(path string, emit Emit)) {
+	RegisterExtractor(FileExtractor{ExtractorName: "chromium_" + name, Family: "chromium", Types: types, LocateFunc: locate, StreamFunc: stream})
+}
+
+// profileFile locates a file of the profile directory
+func profileFile(elem ...string) func(profile Profile) []string {
+	return func(profile Profile) []string {
+		return []string{filepath.Join(append([]string{profile.Path}, elem...)...)}
+	}
+}
+
+func getUserDataPath(profile string, browser string, osName string) []string {
 	output := []string{}
+	home := UserHome(profile)
 	switch osName {
 	case "windows":
 		switch browser {
 		case "chrome":
-			output = append(output, fmt.Sprintf("C:\\Users\\%s\\AppData\\Local\\Google\\Chrome\\User Data\\Default\\", profile))
-			output = append(output, fmt.Sprintf("C:\\Users\\%s\\AppData\\Local\\Google\\Chrome\\User Data\\ChromeDefaultData\\", profile))
-			return output
+			output = append(output, filepath.Join(home, "AppData", "Local", "Google", "Chrome", "User Data"))
 		case "chromium":
-			output = append(output, fmt.Sprintf("C:\\Users\\%s\\AppData\\Local\\Chromium\\User Data\\Default", profile))
-			output = append(output, fmt.Sprintf("C:\\Users\\%s\\AppData\\Local\\Chromium\\User Data\\ChromeDefaultData", profile))
-			return output
+			output = append(output, filepath.Join(home, "AppData", "Local", "Chromium", "User Data"))
 		case "brave":
-			output = append(output, fmt.Sprintf("C:\\Users\\%s\\AppData\\Local\\BraveSoftware\\Brave-Browser\\User Data\\Default", profile))
-			output = append(output, fmt.Sprintf("C:\\Users\\%s\\AppData\\Local\\BraveSoftware\\Brave-Browser\\User Data\\ChromeDefaultData", profile))
-			return output
+			output = append(output, filepath.Join(home, "AppData", "Local", "BraveSoftware", "Brave-Browser", "User Data"))
 		case "edge":
-			output = append(output, fmt.Sprintf("C:\\Users\\%s\\AppData\\Local\\Microsoft\\Edge\\User Data\\Default", profile))
-			output = append(output, fmt.Sprintf("C:\\Users\\%s\\AppData\\Local\\Microsoft\\Edge\\User Data\\ChromeDefaultData", profile))
-			return output
+			output = append(output, filepath.Join(home, "AppData", "Local", "Microsoft", "Edge", "User Data"))
 		case "opera":
-			output = append(output, fmt.Sprintf("C:\\Users\\%s\\AppData\\Roaming\\Opera Software\\Opera Stable\\Default", profile))
-			output = append(output, fmt.Sprintf("C:\\Users\\%s\\AppData\\Roaming\\Opera Software\\Opera Stable\\ChromeDefaultData", profile))
-			return output
+			output = append(output, filepath.Join(home, "AppData", "Roaming", "Opera Software", "Opera Stable"))
 		case "vivaldi":
-			output = append(output, fmt.Sprintf("C:\\Users\\%s\\AppData\\Local\\Vivaldi\\User Data\\Default", profile))
-			output = append(output, fmt.Sprintf("C:\\Users\\%s\\AppData\\Local\\Vivaldi\\User Data\\ChromeDefaultData", profile))
-			return output
+			output = append(output, filepath.Join(home, "AppData", "Local", "Vivaldi", "User Data"))
 		default:
 			return nil
 		}
+		return output
 
 	case "darwin":
-		output = append(output, fmt.Sprintf("/Users/%s/Library/Application Support/Google/Chrome/", profile))
+		applicationSupport := filepath.Join(home, "Library", "Application Support")
+		switch browser {
+		case "chrome":
+			output = append(output, filepath.Join(applicationSupport, "Google", "Chrome"))
+		case "chromium":
+			output = append(output, filepath.Join(applicationSupport, "Chromium"))
+		case "brave":
+			output = append(output, filepath.Join(applicationSupport, "BraveSoftware", "Brave-Browser"))
+		case "edge":
+			output = append(output, filepath.Join(applicationSupport, "Microsoft Edge"))
+		case "opera":
+			output = append(output, filepath.Join(applicationSupport, "com.operasoftware.Opera"))
+		case "vivaldi":
+			output = append(output, filepath.Join(applicationSupport, "Vivaldi"))
+		default:
+			return nil
+		}
 		return output
+
 	case "linux":
-		return []string{fmt.Sprintf("/home/%s/.config/google-chromium/", profile)}
+		// Native package in ~/.config, snap in ~/snap/<name>/, flatpak in ~/.var/app/<id>/config/
+		config := filepath.Join(home, ".config")
+		flatpak := filepath.Join(home, ".var", "app")
+		snap := filepath.Join(home, "snap")
+		switch browser {
+		case "chrome":
+			output = append(output, filepath.Join(config, "google-chrome"))
+			output = append(output, filepath.Join(flatpak, "com.google.Chrome", "config", "google-chrome"))
+		case "chromium":
+			output = append(output, filepath.Join(config, "chromium"))
+			output = append(output, filepath.Join(snap, "chromium", "common", "chromium"))
+			output = append(output, filepath.Join(flatpak, "org.chromium.Chromium", "config", "chromium"))
+		case "brave":
+			output = append(output, filepath.Join(config, "BraveSoftware", "Brave-Browser"))
+			output = append(output, filepath.Join(snap, "brave", "current", ".config", "BraveSoftware", "Brave-Browser"))
+			output = append(output, filepath.Join(flatpak, "com.brave.Browser", "config", "BraveSoftware", "Brave-Browser"))
+		case "edge":
+			output = append(output, filepath.Join(config, "microsoft-edge"))
+			output = append(output, filepath.Join(flatpak, "com.microsoft.Edge", "config", "microsoft-edge"))
+		case "opera":
+			output = append(output, filepath.Join(config, "opera"))
+			output = append(output, filepath.Join(snap, "opera", "current", ".config", "opera"))
+			output = append(output, filepath.Join(flatpak, "com.opera.Opera", "config", "opera"))
+		case "vivaldi":
+			output = append(output, filepath.Join(config, "vivaldi"))
+			output = append(output, filepath.Join(snap, "vivaldi", "current", ".config", "vivaldi"))
+			output = append(output, filepath.Join(flatpak, "com.vivaldi.Vivaldi", "config", "vivaldi"))
+		default:
+			return nil
+		}
+		return output
+
 	default:
 		return output
 	}
 }
 
-func GetChromeArtifacts(profile string, browser string, osName string) []BrowserArtifact {
-	artifacts := []BrowserArtifact{}
-	basePaths := getBasePath(profile, browser, osName)
+// profileListFiles returns the Local State files declaring the profiles of a browser
+func profileListFiles(profile string, browser string, osName string) []string {
+	var files []string
+	for _, userData := range getUserDataPath(profile, browser, osName) {
+		files = append(files, filepath.Join(userData, "Local State"))
+	}
+	return files
+}
+
+// findProfiles lists every profile directory of a browser, as declared in Local State (profile.info_cache)
+// plus any other directory holding a History file (guest profiles, profiles removed from Local State...)
+func findProfiles(profile string, browser string, osName string) []Profile {
+	output := []Profile{}
+
+	for _, userData := range getUserDataPath(profile, browser, osName) {
+		if !CheckPath(userData, true) {
+			log("debug", "profile", "Directory not found : "+userData)
+			continue
+		}
+		found := map[string]bool{}
+		cacheRoot := getCacheRoot(profile, userData, osName)
+
+		for _, browserProfile := range parseLocalState(filepath.Join(userData, "Local State")) {
+			browserProfile.Path = filepath.Join(userData, browserProfile.Directory)
+			browserProfile.CachePath = filepath.Join(cacheRoot, browserProfile.Directory, "Cache")
+			if !CheckPath(browserProfile.Path, true) {
+				log("warn", "profile", "Profile listed in Local State but not found : "+browserProfile.Path)
+				continue
+			}
+			found[browserProfile.Directory] = true
+			output = append(output, browserProfile)
+		}
+
+		// Fallback: directories that contain a History file, including the user data directory itself (Opera)
+		if !found["."] && CheckPath(filepath.Join(userData, "History"), false) {
+			output = append(output, Profile{Path: userData, Directory: ".", CachePath: filepath.Join(cacheRoot, "Cache")})
+		}
+		dir, err := TargetReadDir(userData)
+		if err != nil {
+			log("error", "profile", "Error reading directory: "+err.Error())
+			continue
+		}
+		for _, entry := range dir {
+			if !entry.IsDir() || found[entry.Name()] {
+				continue
+			}
+			if CheckPath(filepath.Join(userData, entry.Name(), "History"), false) {
+				output = append(output, Profile{
+					Path:      filepath.Join(userData, entry.Name()),
+					Directory: entry.Name(),
+					CachePath: filepath.Join(cacheRoot, entry.Name(), "Cache"),
+				})
+			}
+		}
+	}
+
+	for i := range output {
+		output[i].User = profile
+		output[i].Browser = browser
+		output[i].Family = "chromium"
+	}
+	return output
+}
 
-	for _, basePath := range basePaths {
-		artifacts = append(artifacts, processHistory(basePath+"History")...)
-		artifacts = append(artifacts, processDownloads(basePath+"History")...)
-		artifacts = append(artifacts, processBookmarks(basePath+"Bookmarks")...)
-		artifacts = append(artifacts, processCookies(basePath+"Network/Cookies")...)
-		artifacts = append(artifacts, processFormHistory(basePath+"Web Data")...)
-		artifacts = append(artifacts, processLoginData(basePath+"Login Data")...)
-		artifacts = append(artifacts, processExtensions(basePath+"Extensions")...)
-		artifacts = append(artifacts, processFavicons(basePath+"Favicons")...)
-		//artifacts = append(artifacts, processSession(basePath+"Session")...)
-		//artifacts = append(artifacts, processThumbnail(basePath+"Thumbnail")...)
-		artifacts = append(artifacts, processCache(basePath+"Cache")...)
+func parseLocalState(path string) []Profile {
+	if !CheckPath(path, false) {
+		log("debug", "profile", "File not found : "+path)
+		return nil
 	}
 
-	for i, artifact := range artifacts {
-		artifact.User = profile
-		artifact.App = "chromium"
-		artifacts[i] = artifact
+	file, err := TargetOpen(path)
+	if err != nil {
+		log("error", "profile", "Error opening file: "+err.Error())
+		return nil
 	}
+	defer file.Close()
 
-	return artifacts
+	var data localState
+	err = json.NewDecoder(file).Decode(&data)
+	if err != nil {
+		log("error", "profile", "Error decoding JSON: "+err.Error())
+		return nil
+	}
+
+	profiles := []Profile{}
+	for directory, info := range data.Profile.InfoCache {
+		profiles = append(profiles, Profile{
+			Directory: directory,
+			Name:      info.Name,
+			Account:   info.UserName,
+		})
+	}
+	// Map iteration order is random, keep output stable
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].Directory < profiles[j].Directory
+	})
 
+	return profiles
 }
 
 func processHistory(path string) []BrowserArtifact {
@@ -92,19 +233,28 @@ func processHistory(path string) []BrowserArtifact {
 		return []BrowserArtifact{}
 	}
 
-	artifacts := []BrowserArtifact{}
-
 	// Open the database
-	db, err := sql.Open("sqlite3", path)
+	db, err := OpenDatabase(path)
 	if err != nil {
 		log("error", "history", "Error opening database: "+err.Error())
+		return nil
 	}
 	defer db.Close()
 
+	artifacts := queryHistory(db)
+	artifacts = append(artifacts, RecoverFromLogs(path, artifacts, queryHistory)...)
+	artifacts = append(artifacts, carveHistory(db)...)
+
+	log("info", "history", fmt.Sprintf("Found %d history entries in %s", len(artifacts), path))
+	return artifacts
+}
+
+func queryHistory(db *Database) []BrowserArtifact {
+	artifacts := []BrowserArtifact{}
+
 	//This timestamp format is used in web browsers such as Apple Safari (WebKit), Google Chrome and Opera (Chromium/Blink).
-	//It's a 64-bit value for microseconds since Jan 1, 1601 00:00 UTC. One microsecond is one-millionth of a second.
-	//11644474161000000 is the number of microseconds between Jan 1, 1601 and Jan 1, 1970.
-	query := "SELECT history.visit_time - 11644474161000000, history.visit_duration, url.url, url.title, url.visit_count, url.typed_count, ifnull(referrer_url.url,\"\") as referrer, ifnull(referrer_url.title,\"\") as referrer_title  FROM visits as history\nLEFT JOIN urls as url ON url.id = history.url\nLEFT JOIN visits as referrer_history ON referrer_history.id = history.opener_visit OR referrer_history.id = history.from_visit\nLEFT JOIN urls as referrer_url ON referrer_history.url = referrer_url.id;"
+	//It's a 64-bit value for microseconds since Jan 1, 1601 00:00 UTC, see EpochWebKit.
+	query := "SELECT history.visit_time, history.visit_duration, ifnull(url.url,\"\"), ifnull(url.title,\"\"), ifnull(url.visit_count,0), ifnull(url.typed_count,0), ifnull(referrer_url.url,\"\") as referrer, ifnull(referrer_url.title,\"\") as referrer_title  FROM visits as history\nLEFT JOIN urls as url ON url.id = history.url\nLEFT JOIN visits as referrer_history ON referrer_history.id = history.opener_visit OR referrer_history.id = history.from_visit\nLEFT JOIN urls as referrer_url ON referrer_history.url = referrer_url.id;"
 
 	rows, err := db.Query(query)
 	if err != nil {
@@ -133,7 +283,7 @@ func processHistory(path string) []BrowserArtifact {
 
 		artifact := BrowserArtifact{}
 		artifact.ArtifactType = "chrome_history"
-		artifact.Timestamp = row.visit_time
+		artifact.SetTimestamp(int64(row.visit_time), EpochWebKit)
 		artifact.TimestampType = "visit_date"
 		artifact.Title = row.title
 		artifact.Url = row.url
@@ -143,8 +293,91 @@ func processHistory(path string) []BrowserArtifact {
 		artifact.Duration = row.visit_duration
 		artifacts = append(artifacts, artifact)
 	}
+	return artifacts
+}
+
+// carveHistory returns the urls and visits deleted from the database but still found in its free space
+func carveHistory(db *Database) []BrowserArtifact {
+	artifacts := []BrowserArtifact{}
+
+	// Carved visits point to urls still in the database or carved as well
+	urls := map[int]string{}
+	liveUrls := map[string]bool{}
+	rows, err := db.Query("SELECT id, url FROM urls;")
+	if err != nil {
+		log("error", "history", "Error querying database: "+err.Error())
+		return nil
+	}
+	for rows.Next() {
+		var id int
+		var url string
+		if rows.Scan(&id, &url) == nil {
+			urls[id] = url
+			liveUrls[url] = true
+		}
+	}
 
-	log("info", "history", fmt.Sprintf("Found %d history entries in %s", len(artifacts), path))
+	liveVisits := map[string]bool{}
+	rows, err = db.Query("SELECT url, visit_time FROM visits;")
+	if err != nil {
+		log("error", "history", "Error querying database: "+err.Error())
+		return nil
+	}
+	for rows.Next() {
+		var url, visitTime int
+		if rows.Scan(&url, &visitTime) == nil {
+			liveVisits[fmt.Sprintf("%d|%d", url, visitTime)] = true
+		}
+	}
+
+	for _, record := range CarveRecords(db, "urls", "url", "title") {
+		url := record.String("url")
+		if !strings.Contains(url, ":") {
+			continue
+		}
+		if _, ok := urls[int(record.Rowid)]; record.Rowid != 0 && !ok {
+			urls[int(record.Rowid)] = url
+		}
+		if liveUrls[url] {
+			continue
+		}
+
+		artifact := BrowserArtifact{}
+		artifact.ArtifactType = "chrome_history"
+		artifact.TimestampType = "last_visit_time"
+		if IsWebKitTime(int64(record.Int("last_visit_time"))) {
+			artifact.SetTimestamp(int64(record.Int("last_visit_time")), EpochWebKit)
+		}
+		artifact.Title = record.String("title")
+		artifact.Url = url
+		artifact.VisitCount = record.Int("visit_count")
+		artifact.Typed = record.Int("typed_count")
+		artifact.Recovery = "carved"
+		artifact.Confidence = record.Confidence
+		artifacts = append(artifacts, artifact)
+	}
+
+	for _, record := range CarveRecords(db, "visits", "url", "visit_time") {
+		visitTime := record.Int("visit_time")
+		if !IsWebKitTime(int64(visitTime)) || liveVisits[fmt.Sprintf("%d|%d", record.Int("url"), visitTime)] {
+			continue
+		}
+
+		artifact := BrowserArtifact{}
+		artifact.ArtifactType = "chrome_history"
+		artifact.SetTimestamp(int64(visitTime), EpochWebKit)
+		artifact.TimestampType = "visit_date"
+		artifact.Url = urls[record.Int("url")]
+		if artifact.Url == "" {
+			artifact.Metadata = fmt.Sprintf("url id %d", record.Int("url"))
+		}
+		artifact.Duration = record.Int("visit_duration")
+		artifact.Recovery = "carved"
+		artifact.Confidence = record.Confidence
+		artifacts = append(artifacts, artifact)
+	}
+
+	log("info", "history", fmt.Sprintf("Carved %d deleted history entries", len(artifacts)))
 	return artifacts
 }
 
@@ -153,17 +386,25 @@ func processDownloads(path string) []BrowserArtifact {
 		log("error", "downloads", "File not found : "+path)
 		return nil
 	}
-	artifacts := []BrowserArtifact{}
 
 	// Open the database
-	db, err := sql.Open("sqlite3", path)
+	db, err := OpenDatabase(path)
 	if err != nil {
 		log("error", "downloads", "Error opening database: "+err.Error())
 		return nil
 	}
 	defer db.Close()
 
-	query := "SELECT start_time - 11644474161000000 as start_time, target_path,  received_bytes, total_bytes, end_time - 11644474161000000 as end_time, tab_url, tab_referrer_url, mime_type FROM downloads;"
+	artifacts := queryDownloads(db)
+	artifacts = append(artifacts, RecoverFromLogs(path, artifacts, queryDownloads)...)
+
+	return artifacts
+}
+
+func queryDownloads(db *Database) []BrowserArtifact {
+	artifacts := []BrowserArtifact{}
+
+	query := "SELECT start_time, target_path,  received_bytes, total_bytes, end_time, tab_url, tab_referrer_url, mime_type FROM downloads;"
 
 	rows, err := db.Query(query)
 	if err != nil {
@@ -192,7 +433,7 @@ func processDownloads(path string) []BrowserArtifact {
 
 		artifact := BrowserArtifact{}
 		artifact.ArtifactType = "download"
-		artifact.Timestamp = row.start_time
+		artifact.SetTimestamp(int64(row.start_time), EpochWebKit)
 		artifact.Duration = row.end_time - row.start_time
 		artifact.TimestampType = "dateAdded"
 		artifact.Url = row.tab_url
@@ -203,7 +444,6 @@ func processDownloads(path string) []BrowserArtifact {
 		artifact.BytesOut = row.total_bytes - row.received_bytes
 		artifacts = append(artifacts, artifact)
 	}
-
 	return artifacts
 }
 
@@ -217,7 +457,7 @@ func processBookmarks(path string) []BrowserArtifact {
 	artifacts := []BrowserArtifact{}
 
 	// Open JSON file
-	file, err := os.Open(path)
+	file, err := TargetOpen(path)
 	if err != nil {
 		log("error", "bookmarks", "Error opening file: "+err.Error())
 		return nil
@@ -242,7 +482,7 @@ func processBookmarks(path string) []BrowserArtifact {
 		artifact := BrowserArtifact{}
 		artifact.ArtifactType = "bookmark"
 		dateAdded, _ := strconv.Atoi(bookmark.DateAdded)
-		artifact.Timestamp = dateAdded - 11644474161000000
+		artifact.SetTimestamp(int64(dateAdded), EpochWebKit)
 		artifact.TimestampType = "dateAdded"
 		artifact.BookmarkTitle = bookmark.Name
 		artifact.Url = bookmark.URL
@@ -251,7 +491,7 @@ func processBookmarks(path string) []BrowserArtifact {
 		artifact = BrowserArtifact{}
 		artifact.ArtifactType = "bookmark"
 		dateAdded, _ = strconv.Atoi(bookmark.DateLastUsed)
-		artifact.Timestamp = dateAdded - 11644474161000000
+		artifact.SetTimestamp(int64(dateAdded), EpochWebKit)
 		artifact.TimestampType = "dateLastUsed"
 		artifact.BookmarkTitle = bookmark.Name
 		artifact.Url = bookmark.URL
@@ -262,17 +502,37 @@ func processBookmarks(path string) []BrowserArtifact {
 	return artifacts
 }
 
-func processCookies(path string) []BrowserArtifact {
-	artifacts := []BrowserArtifact{}
+func processCookies(path string, emit Emit) {
+	// Check if file exists
+	if !CheckPath(path, false) {
+		log("error", "cookies", "File not found : "+path)
+		return
+	}
 
-	db, err := sql.Open("sqlite3", path)
+	db, err := OpenDatabase(path)
 	if err != nil {
 		log("error", "cookies", "Error opening database: "+err.Error())
-		return nil
+		return
 	}
 	defer db.Close()
 
-	query := "SELECT creation_utc - 11644474161000000, last_access_utc - 11644474161000000, last_update_utc - 11644474161000000, host_key, source_port, name, value FROM cookies;"
+	count := 0
+	counted := func(artifact BrowserArtifact) {
+		count++
+		emit(artifact)
+	}
+	reported, tracked := TrackReported(path, counted)
+	queryCookies(db, tracked)
+	for _, artifact := range RecoverReported(path, reported, CollectQuery(queryCookies)) {
+		counted(artifact)
+	}
+
+	log("info", "cookies", fmt.Sprintf("Found %d cookies in %s", count, path))
+}
+
+func queryCookies(db *Database, emit Emit) {
+
+	query := "SELECT creation_utc, last_access_utc, last_update_utc, host_key, source_port, name, value FROM cookies;"
 	type rowStruct struct {
 		creationTime int
 		lastAccessed int
@@ -286,14 +546,15 @@ func processCookies(path string) []BrowserArtifact {
 	rows, err := db.Query(query)
 	if err != nil {
 		log("error", "cookies", "Error querying database: "+err.Error())
-		return nil
+		return
 	}
+	defer rows.Close()
 	for rows.Next() {
 		row := rowStruct{}
 		err = rows.Scan(&row.creationTime, &row.lastAccessed, &row.lastUpdate, &row.host, &row.sourcePort, &row.name, &row.value)
 		if err != nil {
 			log("error", "cookies", "Error scanning row: "+err.Error())
-			return nil
+			return
 		}
 
 		artifact := BrowserArtifact{}
@@ -301,41 +562,235 @@ func processCookies(path string) []BrowserArtifact {
 		artifact.Url = row.host
 		artifact.Cookie = row.name + "=" + row.value
 		artifact.TimestampType = "creationTime"
-		artifact.Timestamp = row.creationTime
+		artifact.SetTimestamp(int64(row.creationTime), EpochWebKit)
 		artifact.DestPort = row.sourcePort
-		artifacts = append(artifacts, artifact)
+		emit(artifact)
 
 		artifact = BrowserArtifact{}
 		artifact.ArtifactType = "cookie"
 		artifact.Url = row.host
 		artifact.Cookie = row.name + "=" + row.value
 		artifact.TimestampType = "lastAccessed"
-		artifact.Timestamp = row.lastAccessed
+		artifact.SetTimestamp(int64(row.lastAccessed), EpochWebKit)
 		artifact.DestPort = row.sourcePort
-		artifacts = append(artifacts, artifact)
+		emit(artifact)
 
 		artifact = BrowserArtifact{}
 		artifact.ArtifactType = "cookie"
 		artifact.Url = row.host
 		artifact.Cookie = row.name + "=" + row.value
 		artifact.TimestampType = "lastUpdate"
-		artifact.Timestamp = row.lastUpdate
+		artifact.SetTimestamp(int64(row.lastUpdate), EpochWebKit)
 		artifact.DestPort = row.sourcePort
+		emit(artifact)
+	}
+}
+
+func processFormHistory(path string) []BrowserArtifact {
+	// Check if file exists
+	if !CheckPath(path, false) {
+		log("error", "formhistory", "File not found : "+path)
+		return nil
+	}
+
+	// Open the database
+	db, err := OpenDatabase(path)
+	if err != nil {
+		log("error", "formhistory", "Error opening database: "+err.Error())
+		return nil
+	}
+	defer db.Close()
+
+	artifacts := queryFormHistory(db)
+	artifacts = append(artifacts, RecoverFromLogs(path, artifacts, queryFormHistory)...)
+
+	log("info", "formhistory", fmt.Sprintf("Found %d form history entries in %s", len(artifacts), path))
+	return artifacts
+}
+
+func queryFormHistory(db *Database) []BrowserArtifact {
+	artifacts := []BrowserArtifact{}
+
+	// Autofill dates are seconds since 1970
+	query := "SELECT name, value, date_created, date_last_used, count FROM autofill;"
+	rows, err := db.Query(query)
+	if err != nil {
+		log("error", "formhistory", "Error querying database: "+err.Error())
+		return nil
+	}
+
+	type rowStruct struct {
+		name         string
+		value        string
+		dateCreated  int
+		dateLastUsed int
+		count        int
+	}
+
+	for rows.Next() {
+		var row rowStruct
+		err = rows.Scan(&row.name, &row.value, &row.dateCreated, &row.dateLastUsed, &row.count)
+		if err != nil {
+			log("error", "formhistory", "Error scanning row: "+err.Error())
+			continue
+		}
+
+		artifact := BrowserArtifact{}
+		artifact.ArtifactType = "formhistory"
+		artifact.Fieldname = row.name
+		artifact.Value = row.value
+		artifact.VisitCount = row.count
+		artifact.TimestampType = "firstUsed"
+		artifact.SetTimestamp(int64(row.dateCreated), EpochUnixSeconds)
+		artifacts = append(artifacts, artifact)
+
+		artifact = BrowserArtifact{}
+		artifact.ArtifactType = "formhistory"
+		artifact.Fieldname = row.name
+		artifact.Value = row.value
+		artifact.VisitCount = row.count
+		artifact.TimestampType = "lastUsed"
+		artifact.SetTimestamp(int64(row.dateLastUsed), EpochUnixSeconds)
 		artifacts = append(artifacts, artifact)
 	}
+	rows.Close()
 
-	log("info", "cookies", fmt.Sprintf("Found %d cookies in %s", len(artifacts), path))
+	artifacts = append(artifacts, processAutofillProfiles(db)...)
+	artifacts = append(artifacts, processAddresses(db)...)
 	return artifacts
 }
 
-func processFormHistory(path string) []BrowserArtifact {
-	log("debug", "formhistory", "Not implemented yet")
+// processAutofillProfiles reads the saved addresses of the autofill_profiles tables (Chrome < 118)
+func processAutofillProfiles(db *Database) []BrowserArtifact {
+	artifacts := []BrowserArtifact{}
 
+	// Dropped in Chrome 118 in favour of the addresses tables
+	probe, err := db.Query("SELECT 1 FROM autofill_profiles LIMIT 1;")
+	if err != nil {
+		log("debug", "formhistory", "Error querying autofill profiles: "+err.Error())
+		return nil
+	}
+	probe.Close()
+
+	// Each field is queried on its own: a column or table missing in a Chrome version only skips that field
+	fields := [][3]string{
+		{"company_name", "profile.company_name", ""},
+		{"street_address", "profile.street_address", ""},
+		{"city", "profile.city", ""},
+		{"state", "profile.state", ""},
+		{"zipcode", "profile.zipcode", ""},
+		{"country_code", "profile.country_code", ""},
+		{"full_name", "name.full_name", "JOIN autofill_profile_names as name ON name.guid = profile.guid"},
+		{"email", "email.email", "JOIN autofill_profile_emails as email ON email.guid = profile.guid"},
+		{"phone", "phone.number", "JOIN autofill_profile_phones as phone ON phone.guid = profile.guid"},
+	}
+	for _, field := range fields {
+		fieldname := field[0]
+		query := fmt.Sprintf("SELECT profile.guid, ifnull(%s,\"\"), profile.date_modified, profile.use_count, profile.use_date FROM autofill_profiles as profile %s;", field[1], field[2])
+		rows, err := db.Query(query)
+		if err != nil {
+			log("warn", "formhistory", "Skipping autofill profile field "+fieldname+": "+err.Error())
+			continue
+		}
+
+		for rows.Next() {
+			var guid, value string
+			var dateModified, useCount, useDate int
+			err = rows.Scan(&guid, &value, &dateModified, &useCount, &useDate)
+			if err != nil {
+				log("error", "formhistory", "Error scanning row: "+err.Error())
+				continue
+			}
+			if value == "" {
+				continue
+			}
+			artifacts = append(artifacts, autofillProfileArtifacts(guid, fieldname, value, dateModified, useCount, useDate)...)
+		}
+		rows.Close()
+	}
+
+	return artifacts
+}
+
+// processAddresses reads the saved addresses of the addresses tables (Chrome >= 118), fields are typed tokens
+func processAddresses(db *Database) []BrowserArtifact {
 	artifacts := []BrowserArtifact{}
 
+	tables := [][2]string{{"addresses", "address_type_tokens"}, {"local_addresses", "local_addresses_type_tokens"}}
+	for _, tablePair := range tables {
+		table := tablePair[0]
+		query := fmt.Sprintf("SELECT address.guid, token.type, token.value, address.date_modified, address.use_count, address.use_date FROM %s as address\nJOIN %s as token ON token.guid = address.guid;", table, tablePair[1])
+		rows, err := db.Query(query)
+		if err != nil {
+			log("debug", "formhistory", "Error querying "+table+": "+err.Error())
+			continue
+		}
+
+		for rows.Next() {
+			var guid, value string
+			var fieldType, dateModified, useCount, useDate int
+			err = rows.Scan(&guid, &fieldType, &value, &dateModified, &useCount, &useDate)
+			if err != nil {
+				log("error", "formhistory", "Error scanning row: "+err.Error())
+				continue
+			}
+			if value == "" {
+				continue
+			}
+			artifacts = append(artifacts, autofillProfileArtifacts(guid, autofillFieldType(fieldType), value, dateModified, useCount, useDate)...)
+		}
+		rows.Close()
+	}
+
 	return artifacts
 }
 
+func autofillProfileArtifacts(guid string, fieldname string, value string, dateModified int, useCount int, useDate int) []BrowserArtifact {
+	artifacts := []BrowserArtifact{}
+
+	artifact := BrowserArtifact{}
+	artifact.ArtifactType = "autofill_profile"
+	artifact.Metadata = guid
+	artifact.Fieldname = fieldname
+	artifact.Value = value
+	artifact.VisitCount = useCount
+	artifact.TimestampType = "dateModified"
+	artifact.SetTimestamp(int64(dateModified), EpochUnixSeconds)
+	artifacts = append(artifacts, artifact)
+
+	artifact.TimestampType = "lastUsed"
+	artifact.SetTimestamp(int64(useDate), EpochUnixSeconds)
+	artifacts = append(artifacts, artifact)
+
+	return artifacts
+}
+
+// autofillFieldType names the most common autofill FieldType values stored in address_type_tokens
+func autofillFieldType(fieldType int) string {
+	names := map[int]string{
+		3:  "first_name",
+		4:  "middle_name",
+		5:  "last_name",
+		7:  "full_name",
+		9:  "email",
+		14: "phone",
+		30: "address_line1",
+		31: "address_line2",
+		33: "city",
+		34: "state",
+		35: "zipcode",
+		36: "country_code",
+		60: "company_name",
+		77: "street_address",
+		81: "dependent_locality",
+		82: "sorting_code",
+	}
+	if name, ok := names[fieldType]; ok {
+		return name
+	}
+	return fmt.Sprintf("type_%d", fieldType)
+}
+
 func processLoginData(path string) []BrowserArtifact {
 	// Check if file exists
 	if !CheckPath(path, false) {
@@ -343,18 +798,30 @@ func processLoginData(path string) []BrowserArtifact {
 		return nil
 	}
 
-	artifacts := []BrowserArtifact{}
-
 	// Open the database
-	db, err := sql.Open("sqlite3", path)
+	db, err := OpenDatabase(path)
 	if err != nil {
 		log("error", "login", "Error opening database: "+err.Error())
 		return nil
 	}
 	defer db.Close()
 
-	query := "SELECT date_created - 11644474161000000, date_last_used- 11644474161000000, date_password_modified - 11644474161000000, origin_url, username_value, times_used FROM logins;"
+	artifacts := queryLoginData(db)
+	artifacts = append(artifacts, RecoverFromLogs(path, artifacts, queryLoginData)...)
+
+	log("info", "login", fmt.Sprintf("Found %d logins in %s", len(artifacts), path))
+	return artifacts
+}
+
+func queryLoginData(db *Database) []BrowserArtifact {
+	artifacts := []BrowserArtifact{}
+
+	query := "SELECT date_created, date_last_used, date_password_modified, origin_url, username_value, times_used FROM logins;"
 	rows, err := db.Query(query)
+	if err != nil {
+		log("error", "login", "Error querying database: "+err.Error())
+		return nil
+	}
 
 	type rowStruct struct {
 		dateCreated         int
@@ -375,7 +842,7 @@ func processLoginData(path string) []BrowserArtifact {
 
 		artifact := BrowserArtifact{}
 		artifact.ArtifactType = "login"
-		artifact.Timestamp = row.dateCreated
+		artifact.SetTimestamp(int64(row.dateCreated), EpochWebKit)
 		artifact.TimestampType = "dateCreated"
 		artifact.Url = row.originUrl
 		artifact.Fieldname = "username"
@@ -384,7 +851,7 @@ func processLoginData(path string) []BrowserArtifact {
 
 		artifact = BrowserArtifact{}
 		artifact.ArtifactType = "login"
-		artifact.Timestamp = row.dateLastUsed
+		artifact.SetTimestamp(int64(row.dateLastUsed), EpochWebKit)
 		artifact.TimestampType = "lastUsed"
 		artifact.Url = row.originUrl
 		artifact.Fieldname = "username"
@@ -393,7 +860,7 @@ func processLoginData(path string) []BrowserArtifact {
 
 		artifact = BrowserArtifact{}
 		artifact.ArtifactType = "login"
-		artifact.Timestamp = row.datePasswordChanged
+		artifact.SetTimestamp(int64(row.datePasswordChanged), EpochWebKit)
 		artifact.TimestampType = "passwordChanged"
 		artifact.Url = row.originUrl
 		artifact.Fieldname = "username"
@@ -401,7 +868,6 @@ func processLoginData(path string) []BrowserArtifact {
 		artifacts = append(artifacts, artifact)
 
 	}
-	log("info", "login", fmt.Sprintf("Found %d logins in %s", len(artifacts), path))
 	return artifacts
 }
 
@@ -415,7 +881,7 @@ func processExtensions(path string) []BrowserArtifact {
 
 	// Find manifest.json files in Extensions/<name>/<version>/manifest.json
 	// List all directories in Extensions
-	dirs, err := os.ReadDir(path)
+	dirs, err := TargetReadDir(path)
 	if err != nil {
 		log("error", "extensions", "Error reading directory: "+err.Error())
 		return nil
@@ -427,7 +893,7 @@ func processExtensions(path string) []BrowserArtifact {
 			continue
 		}
 		// List all directories in Extensions/<name>
-		versions, err := os.ReadDir(path + "/" + dir.Name())
+		versions, err := TargetReadDir(path + "/" + dir.Name())
 		if err != nil {
 			log("error", "extensions", "Error reading directory: "+err.Error())
 			return nil
@@ -446,7 +912,7 @@ func processExtensions(path string) []BrowserArtifact {
 			}
 
 			// Open manifest.json
-			file, err := os.Open(manifestPath)
+			file, err := TargetOpen(manifestPath)
 			if err != nil {
 				log("error", "extensions", "Error opening file: "+err.Error())
 				continue
@@ -467,7 +933,7 @@ func processExtensions(path string) []BrowserArtifact {
 			extension.ArtifactType = "extension"
 			extension.AddonName = data.Name
 			extension.TimestampType = "now"
-			extension.Timestamp = int(time.Now().UnixMicro())
+			extension.SetCollectionTime()
 			extension.Version = data.Version
 			extension.SourceURI = data.UpdateURL
 			extension.CreatorName = data.Author
@@ -488,16 +954,23 @@ func processFavicons(path string) []BrowserArtifact {
 		return nil
 	}
 
-	artifacts := []BrowserArtifact{}
-
 	// Open the database
-	db, err := sql.Open("sqlite3", path)
+	db, err := OpenDatabase(path)
 	if err != nil {
 		log("error", "favicons", "Error opening database: "+err.Error())
 		return nil
 	}
 	defer db.Close()
 
+	artifacts := queryFavicons(db)
+	artifacts = append(artifacts, RecoverFromLogs(path, artifacts, queryFavicons)...)
+
+	return artifacts
+}
+
+func queryFavicons(db *Database) []BrowserArtifact {
+	artifacts := []BrowserArtifact{}
+
 	query := "SELECT favicon.url as url, map.page_url as referrer, last_updated, last_requested\nFROM favicons as favicon\nLEFT JOIN favicon_bitmaps as bitmap ON favicon.id=bitmap.icon_id\nLEFT JOIN icon_mapping as map ON favicon.id=map.icon_id\n"
 
 	rows, err := db.Query(query)
@@ -529,24 +1002,16 @@ func processFavicons(path string) []BrowserArtifact {
 		artifact.Url = row.iconUrl
 
 		if row.lastUpdated != 0 {
-			artifact.Timestamp = row.lastUpdated
+			artifact.SetTimestamp(int64(row.lastUpdated), EpochWebKit)
 			artifact.TimestampType = "lastUpdated"
 		} else if row.lastRequested != 0 {
-			artifact.Timestamp = row.lastRequested
+			artifact.SetTimestamp(int64(row.lastRequested), EpochWebKit)
 			artifact.TimestampType = "lastRequested"
 		} else {
-			artifact.Timestamp = int(time.Now().UnixMicro())
+			artifact.SetCollectionTime()
 			artifact.TimestampType = "unknown"
 		}
 
 	}
-
-	return artifacts
-}
-
-func processCache(path string) []BrowserArtifact {
-	log("debug", "cache", "Not implemented yet")
-	artifacts := []BrowserArtifact{}
-
 	return artifacts
 }
@@ -0,0 +1,516 @@
+package chromium
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	. "local/BrowserArtifact/src"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+/*
+SNSS files are a sequence of commands replayed by the browser to restore its state:
+  - Current Session / Last Session, Sessions/Session_*: windows and tabs of the session (session service commands)
+  - Current Tabs / Last Tabs, Sessions/Tabs_*: recently closed tabs and windows (tab restore service commands)
+
+File format: "SNSS" magic, int32 version, then commands made of a uint16 size, a uint8 id and size-1 bytes of payload.
+*/
+
+func init() {
+	// The session files are looked for in the profile directory, only they are collected
+	RegisterExtractor(FileExtractor{ExtractorName: "chromium_session", Family: "chromium", Types: "session", LocateFunc: profileFile(), ExtractFunc: processSession,
+		SourcesFunc: func(profile Profile) []string {
+			return getSessionFiles(profile.Path)
+		}})
+}
+
+const snssMagic = "SNSS"
+
+// Session service commands
+const (
+	sessionSetTabWindow               = 0
+	sessionSetTabIndexInWindow        = 2
+	sessionUpdateTabNavigation        = 6
+	sessionSetSelectedNavigationIndex = 7
+	sessionTabClosed                  = 16
+	sessionWindowClosed               = 17
+	sessionLastActiveTime             = 21
+)
+
+// Tab restore service commands
+const (
+	tabRestoreUpdateTabNavigation     = 1
+	tabRestoreWindowDeprecated        = 3
+	tabRestoreSelectedNavigationInTab = 4
+	tabRestoreWindow                  = 9
+)
+
+type snssCommand struct {
+	id      uint8
+	payload []byte
+}
+
+type sessionNavigation struct {
+	index          int
+	url            string
+	title          string
+	referrer       string
+	transition     uint32
+	timestamp      int // WebKit microseconds
+	httpStatusCode int
+}
+
+type sessionTab struct {
+	id             int
+	window         int
+	index          int
+	selected       int
+	closed         bool
+	closeTime      int
+	lastActiveTime int
+	navigations    map[int]sessionNavigation
+}
+
+type sessionWindow struct {
+	id        int
+	closed    bool
+	closeTime int
+}
+
+// pickleReader reads base::Pickle payloads: 4-byte aligned fields after a uint32 payload size
+type pickleReader struct {
+	data   []byte
+	offset int
+}
+
+func newPickleReader(data []byte) *pickleReader {
+	return &pickleReader{data: data, offset: 4}
+}
+
+func (p *pickleReader) next(size int) ([]byte, error) {
+	aligned := (size + 3) &^ 3
+	if size < 0 || p.offset+size > len(p.data) {
+		return nil, errors.New("pickle too short")
+	}
+	value := p.data[p.offset : p.offset+size]
+	p.offset += aligned
+	return value, nil
+}
+
+func (p *pickleReader) int32() (int, error) {
+	value, err := p.next(4)
+	if err != nil {
+		return 0, err
+	}
+	return int(int32(binary.LittleEndian.Uint32(value))), nil
+}
+
+func (p *pickleReader) int64() (int, error) {
+	value, err := p.next(8)
+	if err != nil {
+		return 0, err
+	}
+	return int(int64(binary.LittleEndian.Uint64(value))), nil
+}
+
+func (p *pickleReader) string() (string, error) {
+	length, err := p.int32()
+	if err != nil {
+		return "", err
+	}
+	value, err := p.next(length)
+	return string(value), err
+}
+
+func (p *pickleReader) string16() (string, error) {
+	length, err := p.int32()
+	if err != nil {
+		return "", err
+	}
+	value, err := p.next(length * 2)
+	if err != nil {
+		return "", err
+	}
+	chars := make([]uint16, length)
+	for i := range chars {
+		chars[i] = binary.LittleEndian.Uint16(value[i*2:])
+	}
+	return string(utf16.Decode(chars)), nil
+}
+
+func readSNSS(path string) ([]snssCommand, error) {
+	data, err := TargetReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 8 || string(data[0:4]) != snssMagic {
+		return nil, errors.New("not a SNSS file")
+	}
+
+	commands := []snssCommand{}
+	offset := 8
+	for offset+2 <= len(data) {
+		size := int(binary.LittleEndian.Uint16(data[offset:]))
+		offset += 2
+		if size == 0 || offset+size > len(data) {
+			// Truncated command, the file is being written
+			break
+		}
+		commands = append(commands, snssCommand{id: data[offset], payload: data[offset+1 : offset+size]})
+		offset += size
+	}
+	return commands, nil
+}
+
+// parseNavigation decodes a pickled tab id followed by a SerializedNavigationEntry
+func parseNavigation(payload []byte) (int, sessionNavigation, error) {
+	navigation := sessionNavigation{}
+	pickle := newPickleReader(payload)
+
+	tabID, err := pickle.int32()
+	if err != nil {
+		return 0, navigation, err
+	}
+	if navigation.index, err = pickle.int32(); err != nil {
+		return tabID, navigation, err
+	}
+	if navigation.url, err = pickle.string(); err != nil {
+		return tabID, navigation, err
+	}
+	if navigation.title, err = pickle.string16(); err != nil {
+		return tabID, navigation, err
+	}
+	// Page state
+	if _, err = pickle.string(); err != nil {
+		return tabID, navigation, err
+	}
+	transition, err := pickle.int32()
+	if err != nil {
+		return tabID, navigation, err
+	}
+	navigation.transition = uint32(transition)
+
+	// Fields below were added over time, older files stop here
+	if _, err = pickle.int32(); err != nil { // type mask
+		return tabID, navigation, nil
+	}
+	if navigation.referrer, err = pickle.string(); err != nil {
+		return tabID, navigation, nil
+	}
+	if _, err = pickle.int32(); err != nil { // obsolete referrer policy
+		return tabID, navigation, nil
+	}
+	if _, err = pickle.string(); err != nil { // original request url
+		return tabID, navigation, nil
+	}
+	if _, err = pickle.int32(); err != nil { // is overriding user agent
+		return tabID, navigation, nil
+	}
+	timestamp, err := pickle.int64()
+	if err != nil {
+		return tabID, navigation, nil
+	}
+	navigation.timestamp = int(timestamp)
+	if _, err = pickle.string16(); err != nil { // obsolete search terms
+		return tabID, navigation, nil
+	}
+	navigation.httpStatusCode, _ = pickle.int32()
+
+	return tabID, navigation, nil
+}
+
+// transitionString decodes a ui::PageTransition: a core type and qualifier flags
+func transitionString(transition uint32) string {
+	coreTypes := []string{"LINK", "TYPED", "AUTO_BOOKMARK", "AUTO_SUBFRAME", "MANUAL_SUBFRAME", "GENERATED",
+		"AUTO_TOPLEVEL", "FORM_SUBMIT", "RELOAD", "KEYWORD", "KEYWORD_GENERATED"}
+	qualifiers := []struct {
+		mask uint32
+		name string
+	}{
+		{0x00800000, "BLOCKED"},
+		{0x01000000, "FORWARD_BACK"},
+		{0x02000000, "FROM_ADDRESS_BAR"},
+		{0x04000000, "HOME_PAGE"},
+		{0x08000000, "FROM_API"},
+		{0x10000000, "CHAIN_START"},
+		{0x20000000, "CHAIN_END"},
+		{0x40000000, "CLIENT_REDIRECT"},
+		{0x80000000, "SERVER_REDIRECT"},
+	}
+
+	core := int(transition & 0xff)
+	parts := []string{fmt.Sprintf("UNKNOWN_%d", core)}
+	if core < len(coreTypes) {
+		parts[0] = coreTypes[core]
+	}
+	for _, qualifier := range qualifiers {
+		if transition&qualifier.mask != 0 {
+			parts = append(parts, qualifier.name)
+		}
+	}
+	return strings.Join(parts, "|")
+}
+
+func payloadInt(payload []byte, offset int) int {
+	if offset+4 > len(payload) {
+		return 0
+	}
+	return int(int32(binary.LittleEndian.Uint32(payload[offset:])))
+}
+
+// payloadTime reads a WebKit time
+func payloadTime(payload []byte, offset int) int {
+	if offset+8 > len(payload) {
+		return 0
+	}
+	return int(int64(binary.LittleEndian.Uint64(payload[offset:])))
+}
+
+// parseSessionFile replays session service commands into windows and tabs
+func parseSessionFile(commands []snssCommand) (map[int]*sessionWindow, map[int]*sessionTab) {
+	windows := map[int]*sessionWindow{}
+	tabs := map[int]*sessionTab{}
+
+	getTab := func(id int) *sessionTab {
+		if _, ok := tabs[id]; !ok {
+			tabs[id] = &sessionTab{id: id, navigations: map[int]sessionNavigation{}}
+		}
+		return tabs[id]
+	}
+	getWindow := func(id int) *sessionWindow {
+		if _, ok := windows[id]; !ok {
+			windows[id] = &sessionWindow{id: id}
+		}
+		return windows[id]
+	}
+
+	for _, command := range commands {
+		switch command.id {
+		case sessionSetTabWindow:
+			tab := getTab(payloadInt(command.payload, 4))
+			tab.window = getWindow(payloadInt(command.payload, 0)).id
+		case sessionSetTabIndexInWindow:
+			getTab(payloadInt(command.payload, 0)).index = payloadInt(command.payload, 4)
+		case sessionSetSelectedNavigationIndex:
+			getTab(payloadInt(command.payload, 0)).selected = payloadInt(command.payload, 4)
+		case sessionUpdateTabNavigation:
+			tabID, navigation, err := parseNavigation(command.payload)
+			if err != nil {
+				log("debug", "session", "Error parsing navigation: "+err.Error())
+				continue
+			}
+			getTab(tabID).navigations[navigation.index] = navigation
+		case sessionTabClosed:
+			tab := getTab(payloadInt(command.payload, 0))
+			tab.closed = true
+			tab.closeTime = payloadTime(command.payload, 8)
+		case sessionWindowClosed:
+			window := getWindow(payloadInt(command.payload, 0))
+			window.closed = true
+			window.closeTime = payloadTime(command.payload, 8)
+		case sessionLastActiveTime:
+			getTab(payloadInt(command.payload, 0)).lastActiveTime = payloadTime(command.payload, 8)
+		}
+	}
+
+	return windows, tabs
+}
+
+// parseTabRestoreFile replays tab restore service commands: every tab found there has been closed
+func parseTabRestoreFile(commands []snssCommand) (map[int]*sessionWindow, map[int]*sessionTab) {
+	windows := map[int]*sessionWindow{}
+	tabs := map[int]*sessionTab{}
+
+	currentWindow := 0
+	remainingTabs := 0
+	for _, command := range commands {
+		switch command.id {
+		case tabRestoreWindow, tabRestoreWindowDeprecated:
+			// Window id, selected tab index, number of tabs, close time
+			// The newer command is a pickle (size header, 4-byte aligned int64), the deprecated one a C struct
+			payload := command.payload
+			closeTimeOffset := 16
+			if command.id == tabRestoreWindow && len(payload) >= 4 {
+				payload = payload[4:]
+				closeTimeOffset = 12
+			}
+			currentWindow = payloadInt(payload, 0)
+			remainingTabs = payloadInt(payload, 8)
+			closeTime := payloadTime(payload, closeTimeOffset)
+			windows[currentWindow] = &sessionWindow{id: currentWindow, closed: true, closeTime: closeTime}
+		case tabRestoreSelectedNavigationInTab:
+			tab := &sessionTab{
+				id:          payloadInt(command.payload, 0),
+				selected:    payloadInt(command.payload, 4),
+				closed:      true,
+				closeTime:   payloadTime(command.payload, 8),
+				navigations: map[int]sessionNavigation{},
+			}
+			if remainingTabs > 0 {
+				tab.window = currentWindow
+				remainingTabs--
+			}
+			tabs[tab.id] = tab
+		case tabRestoreUpdateTabNavigation:
+			tabID, navigation, err := parseNavigation(command.payload)
+			if err != nil {
+				log("debug", "session", "Error parsing navigation: "+err.Error())
+				continue
+			}
+			if tab, ok := tabs[tabID]; ok {
+				tab.navigations[navigation.index] = navigation
+			}
+		}
+	}
+
+	return windows, tabs
+}
+
+// getSessionFiles lists the SNSS files of a profile, old single-file layout and Sessions/ directory
+func getSessionFiles(path string) []string {
+	files := []string{}
+	for _, name := range []string{"Current Session", "Last Session", "Current Tabs", "Last Tabs"} {
+		if CheckPath(filepath.Join(path, name), false) {
+			files = append(files, filepath.Join(path, name))
+		}
+	}
+
+	dir, err := TargetReadDir(filepath.Join(path, "Sessions"))
+	if err != nil {
+		return files
+	}
+	for _, entry := range dir {
+		if !entry.IsDir() && (strings.HasPrefix(entry.Name(), "Session_") || strings.HasPrefix(entry.Name(), "Tabs_")) {
+			files = append(files, filepath.Join(path, "Sessions", entry.Name()))
+		}
+	}
+	return files
+}
+
+func processSession(path string) []BrowserArtifact {
+	files := getSessionFiles(path)
+	if len(files) == 0 {
+		log("error", "session", "No session file found in : "+path)
+		return nil
+	}
+
+	artifacts := []BrowserArtifact{}
+	for _, file := range files {
+		commands, err := readSNSS(file)
+		if err != nil {
+			log("error", "session", "Error reading session file "+file+": "+err.Error())
+			continue
+		}
+
+		name := filepath.Base(file)
+		var windows map[int]*sessionWindow
+		var tabs map[int]*sessionTab
+		if strings.HasSuffix(name, "Tabs") || strings.HasPrefix(name, "Tabs_") {
+			windows, tabs = parseTabRestoreFile(commands)
+		} else {
+			windows, tabs = parseSessionFile(commands)
+		}
+		artifacts = append(artifacts, sessionArtifacts(name, windows, tabs)...)
+	}
+
+	log("info", "session", fmt.Sprintf("Found %d session entries in %s", len(artifacts), path))
+	return artifacts
+}
+
+func sessionArtifacts(source string, windows map[int]*sessionWindow, tabs map[int]*sessionTab) []BrowserArtifact {
+	artifacts := []BrowserArtifact{}
+
+	// Map iteration order is random, keep output stable
+	tabIDs := []int{}
+	for id := range tabs {
+		tabIDs = append(tabIDs, id)
+	}
+	sort.Ints(tabIDs)
+
+	for _, id := range tabIDs {
+		tab := tabs[id]
+		action := "open"
+		if window, ok := windows[tab.window]; tab.closed || (ok && window.closed) {
+			action = "closed"
+		}
+
+		indexes := []int{}
+		for index := range tab.navigations {
+			indexes = append(indexes, index)
+		}
+		sort.Ints(indexes)
+
+		for _, index := range indexes {
+			navigation := tab.navigations[index]
+			artifact := BrowserArtifact{}
+			artifact.ArtifactType = "session"
+			artifact.Action = action
+			artifact.Url = navigation.url
+			artifact.Title = navigation.title
+			artifact.HttpReferrer = navigation.referrer
+			artifact.Transition = transitionString(navigation.transition)
+			if navigation.httpStatusCode != 0 {
+				artifact.Status = fmt.Sprintf("%d", navigation.httpStatusCode)
+			}
+			artifact.SessionWindow = tab.window
+			artifact.SessionTab = tab.id
+			artifact.NavigationIndex = navigation.index
+			artifact.TimestampType = "navigation (" + source + ")"
+			artifact.SetTimestamp(int64(navigation.timestamp), EpochWebKit)
+			artifacts = append(artifacts, artifact)
+		}
+
+		// Tab level events carry the URL displayed by the tab
+		current := tab.navigations[tab.selected]
+		if tab.closeTime != 0 {
+			artifact := BrowserArtifact{}
+			artifact.ArtifactType = "session"
+			artifact.Action = "tab_closed"
+			artifact.Url = current.url
+			artifact.Title = current.title
+			artifact.SessionWindow = tab.window
+			artifact.SessionTab = tab.id
+			artifact.NavigationIndex = tab.selected
+			artifact.TimestampType = "closed (" + source + ")"
+			artifact.SetTimestamp(int64(tab.closeTime), EpochWebKit)
+			artifacts = append(artifacts, artifact)
+		}
+		if tab.lastActiveTime != 0 {
+			artifact := BrowserArtifact{}
+			artifact.ArtifactType = "session"
+			artifact.Action = action
+			artifact.Url = current.url
+			artifact.Title = current.title
+			artifact.SessionWindow = tab.window
+			artifact.SessionTab = tab.id
+			artifact.NavigationIndex = tab.selected
+			artifact.TimestampType = "lastActive (" + source + ")"
+			artifact.SetTimestamp(int64(tab.lastActiveTime), EpochWebKit)
+			artifacts = append(artifacts, artifact)
+		}
+	}
+
+	windowIDs := []int{}
+	for id := range windows {
+		windowIDs = append(windowIDs, id)
+	}
+	sort.Ints(windowIDs)
+	for _, id := range windowIDs {
+		window := windows[id]
+		if window.closeTime == 0 {
+			continue
+		}
+		artifact := BrowserArtifact{}
+		artifact.ArtifactType = "session"
+		artifact.Action = "window_closed"
+		artifact.SessionWindow = window.id
+		artifact.TimestampType = "closed (" + source + ")"
+		artifact.SetTimestamp(int64(window.closeTime), EpochWebKit)
+		artifacts = append(artifacts, artifact)
+	}
+
+	return artifacts
+}
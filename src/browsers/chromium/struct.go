@@ -1,5 +1,18 @@
 package chromium
 
+type localState struct {
+	Profile struct {
+		InfoCache map[string]struct {
+			Name       string  `json:"name"`
+			GaiaName   string  `json:"gaia_name"`
+			GaiaID     string  `json:"gaia_id"`
+			UserName   string  `json:"user_name"`
+			ActiveTime float64 `json:"active_time"`
+		} `json:"info_cache"`
+		LastUsed string `json:"last_used"`
+	} `json:"profile"`
+}
+
 type bookmark struct {
 	Checksum string `json:"checksum"`
 	Roots    struct {
@@ -77,12 +90,6 @@ type bookmark struct {
 				Type         string `json:"type"`
 				URL          string `json:"url,omitempty"`
 				MetaInfo     struct {
-					LastVisited string `json:"last_visited"`
-				} `json:"meta_info,omitempty"`
-				MetaInfo0 struct {
-					LastVisitedDesktop string `json:"last_visited_desktop"`
-				} `json:"meta_info,omitempty"`
-				MetaInfo1 struct {
 					LastVisited        string `json:"last_visited"`
 					LastVisitedDesktop string `json:"last_visited_desktop"`
 				} `json:"meta_info,omitempty"`
@@ -2,15 +2,16 @@ package firefox
 
 import (
 	"bytes"
-	"database/sql"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
-	_ "github.com/mattn/go-sqlite3"
 	"github.com/pierrec/lz4"
 	"io"
 	. "local/BrowserArtifact/src"
-	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 )
 
 const chunkSize = 256 * 1024
@@ -19,65 +20,195 @@ func log(level string, source string, message string) {
 	Log.Log(level, "firefox", source, message)
 }
 
+func init() {
+	RegisterBrowser(Browser{Name: "firefox", Family: "firefox", FindProfiles: findProfiles, Files: profileListFiles})
+
+	register("history", "history", profileFile("places.sqlite"), processHistory)
+	register("downloads", "download", profileFile("places.sqlite"), processDownloads)
+	register("bookmarks", "bookmark", profileFile("places.sqlite"), processBookmarks)
+	register("formhistory", "formhistory", profileFile("formhistory.sqlite"), processFormHistory)
+	registerStream("cookies", "cookie", profileFile("cookies.sqlite"), processCookies)
+	registerStream("cache", "cache", func(profile Profile) []string {
+		return []string{profile.CachePath}
+	}, processCache)
+	register("favicons", "favicon", profileFile("favicons.sqlite"), processFavicons)
+	register("logins", "login", profileFile("logins.json"), processLogins)
+	register("addons", "addon", profileFile("addons.json"), processAddons)
+	register("extensions", "extension", profileFile("extensions.json"), processExtensions)
+	register("bookmarks_backup", "bookmark", profileFile("bookmarkbackups"), processBookmarksBackup)
+}
+
+func register(name string, types string, locate func(profile Profile) []string, extract func(path string) []BrowserArtifact) {
+	RegisterExtractor(FileExtractor{ExtractorName: "firefox_" + name, Family: "firefox", Types: types, LocateFunc: locate, ExtractFunc: extract})
+}
+
+// registerStream registers an extractor emitting its artifacts as they are parsed
+func registerStream(name string, types string, locate func(profile Profile) []string, stream func(path string, emit Emit)) {
+	RegisterExtractor(FileExtractor{ExtractorName: "firefox_" + name, Family: "firefox", Types: types, LocateFunc: locate, StreamFunc: stream})
+}
+
+// profileFile locates a file of the profile directory
+func profileFile(elem ...string) func(profile Profile) []string {
+	return func(profile Profile) []string {
+		return []string{filepath.Join(append([]string{profile.Path}, elem...)...)}
+	}
+}
+
+// getBasePath returns the Firefox directory holding profiles.ini, and the local one holding caches (Windows only)
 func getBasePath(profile string, osName string) (string, string) {
+	home := UserHome(profile)
 	switch osName {
 	case "windows":
-		return fmt.Sprintf("C:\\Users\\%s\\AppData\\Roaming\\Mozilla\\firefox\\Profiles\\", profile), fmt.Sprintf("C:\\Users\\%s\\AppData\\Local\\Mozilla\\firefox\\Profiles\\", profile)
+		return filepath.Join(home, "AppData", "Roaming", "Mozilla", "Firefox"), filepath.Join(home, "AppData", "Local", "Mozilla", "Firefox")
 	case "darwin":
-		return fmt.Sprintf("/Users/%s/Library/Application Support/firefox/Profiles/", profile), ""
+		return filepath.Join(home, "Library", "Application Support", "Firefox"), ""
 	case "linux":
-		return fmt.Sprintf("/home/%s/.mozilla/firefox/", profile), ""
+		return filepath.Join(home, ".mozilla", "firefox"), ""
 	default:
 		return "", ""
 	}
 }
 
-func getFirefoxProfile(basePath string) []string {
-	var profiles []string
-	dir, err := os.ReadDir(basePath)
+// profileListFiles returns the files declaring the Firefox profiles of a user
+func profileListFiles(profile string, browser string, osName string) []string {
+	basePath, _ := getBasePath(profile, osName)
+	if basePath == "" {
+		return nil
+	}
+	return []string{filepath.Join(basePath, "profiles.ini"), filepath.Join(basePath, "installs.ini")}
+}
+
+// parseIni reads a profiles.ini / installs.ini file, sections are kept in file order
+func parseIni(path string) ([]iniSection, error) {
+	content, err := TargetReadFile(path)
 	if err != nil {
-		return profiles
+		return nil, err
 	}
-	for _, entry := range dir {
-		if entry.IsDir() {
-			profiles = append(profiles, entry.Name())
+
+	var sections []iniSection
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			sections = append(sections, iniSection{Name: line[1 : len(line)-1], Values: map[string]string{}})
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found || len(sections) == 0 {
+			continue
 		}
+		sections[len(sections)-1].Values[strings.TrimSpace(key)] = strings.TrimSpace(value)
 	}
-	return profiles
+	return sections, nil
 }
 
-func GetFirefoxArtifacts(profile string, osName string) []BrowserArtifact {
-	var artifacts []BrowserArtifact
-	basePath, localBasePath := getBasePath(profile, osName)
-	firefoxProfiles := getFirefoxProfile(basePath)
+// getFirefoxProfile lists the profiles declared in profiles.ini, flagging the default ones from installs.ini.
+// Without profiles.ini, every subdirectory of the Profiles folder is taken as a profile.
+func getFirefoxProfile(basePath string, localBasePath string) []firefoxProfile {
+	var profiles []firefoxProfile
+
+	localPath := func(relative string) string {
+		if localBasePath == "" {
+			return filepath.Join(basePath, relative)
+		}
+		return filepath.Join(localBasePath, relative)
+	}
+
+	sections, err := parseIni(filepath.Join(basePath, "profiles.ini"))
+	if err != nil {
+		log("warn", "profile", "Error reading profiles.ini, listing profile directories instead: "+err.Error())
+		profilesPath := filepath.Join(basePath, "Profiles")
+		relativeTo := "Profiles"
+		if !CheckPath(profilesPath, true) {
+			profilesPath = basePath
+			relativeTo = ""
+		}
+		dir, err := TargetReadDir(profilesPath)
+		if err != nil {
+			return profiles
+		}
+		for _, entry := range dir {
+			if entry.IsDir() && CheckPath(filepath.Join(profilesPath, entry.Name(), "places.sqlite"), false) {
+				profiles = append(profiles, firefoxProfile{
+					Name:      entry.Name(),
+					Path:      filepath.Join(profilesPath, entry.Name()),
+					LocalPath: localPath(filepath.Join(relativeTo, entry.Name())),
+				})
+			}
+		}
+		return profiles
+	}
+
+	// Default profile of each install, from installs.ini and the [Install*] sections of profiles.ini
+	installs := map[string]string{}
+	installSections, err := parseIni(filepath.Join(basePath, "installs.ini"))
+	if err != nil {
+		log("debug", "profile", "Error reading installs.ini: "+err.Error())
+	}
+	for _, section := range installSections {
+		installs[section.Values["Default"]] = section.Name
+	}
+	for _, section := range sections {
+		if strings.HasPrefix(section.Name, "Install") {
+			installs[section.Values["Default"]] = strings.TrimPrefix(section.Name, "Install")
+		}
+	}
 
-	for _, firefoxProfile := range firefoxProfiles {
-		artifacts = append(artifacts, processHistory(basePath+firefoxProfile+"/places.sqlite")...)
-		artifacts = append(artifacts, processDownloads(basePath+firefoxProfile+"/places.sqlite")...)
-		artifacts = append(artifacts, processBookmarks(basePath+firefoxProfile+"/places.sqlite")...)
-		artifacts = append(artifacts, processFormHistory(basePath+firefoxProfile+"/formhistory.sqlite")...)
-		artifacts = append(artifacts, processCookies(basePath+firefoxProfile+"/cookies.sqlite")...)
+	for _, section := range sections {
+		if !strings.HasPrefix(section.Name, "Profile") {
+			continue
+		}
+		relativePath := section.Values["Path"]
+		if relativePath == "" {
+			continue
+		}
 
-		if localBasePath != "" {
-			artifacts = append(artifacts, processCache(localBasePath+firefoxProfile+"/cache2/")...)
+		profile := firefoxProfile{Name: section.Values["Name"]}
+		if section.Values["IsRelative"] == "0" {
+			profile.Path = TargetAbsPath(relativePath)
+			profile.LocalPath = profile.Path
 		} else {
-			artifacts = append(artifacts, processCache(basePath+firefoxProfile+"/cache2/")...)
+			relative := filepath.FromSlash(relativePath)
+			profile.Path = filepath.Join(basePath, relative)
+			profile.LocalPath = localPath(relative)
 		}
+		installHash, isInstallDefault := installs[relativePath]
+		profile.InstallHash = installHash
+		profile.IsDefault = isInstallDefault || section.Values["Default"] == "1"
 
-		artifacts = append(artifacts, processFavicons(basePath+firefoxProfile+"/favicons.sqlite")...)
-		artifacts = append(artifacts, processLogins(basePath+firefoxProfile+"/logins.json")...)
-		artifacts = append(artifacts, processAddons(basePath+firefoxProfile+"/addons.json")...)
-		artifacts = append(artifacts, processExtensions(basePath+firefoxProfile+"/extensions.json")...)
-		artifacts = append(artifacts, processBookmarksBackup(basePath+firefoxProfile+"/bookmarkbackups")...)
+		if !CheckPath(profile.Path, true) {
+			log("warn", "profile", "Profile listed in profiles.ini but not found: "+profile.Path)
+			continue
+		}
+		profiles = append(profiles, profile)
 	}
 
-	for i, artifact := range artifacts {
-		artifact.User = profile
-		artifact.App = "firefox"
-		artifacts[i] = artifact
+	return profiles
+}
+
+// findProfiles lists the Firefox profiles of a user
+func findProfiles(profile string, browser string, osName string) []Profile {
+	var profiles []Profile
+	basePath, localBasePath := getBasePath(profile, osName)
+
+	for _, firefoxProfile := range getFirefoxProfile(basePath, localBasePath) {
+		log("debug", "profile", fmt.Sprintf("Found profile %s (default: %t, install: %s) in %s", firefoxProfile.Name, firefoxProfile.IsDefault, firefoxProfile.InstallHash, firefoxProfile.Path))
+		profiles = append(profiles, Profile{
+			User:      profile,
+			Browser:   browser,
+			Family:    "firefox",
+			Path:      firefoxProfile.Path,
+			CachePath: filepath.Join(firefoxProfile.LocalPath, "cache2"),
+			Directory: filepath.Base(firefoxProfile.Path),
+			Name:      firefoxProfile.Name,
+			Default:   firefoxProfile.IsDefault,
+			Install:   firefoxProfile.InstallHash,
+		})
 	}
 
-	return artifacts
+	return profiles
 }
 
 func processHistory(path string) []BrowserArtifact {
@@ -85,16 +216,26 @@ func processHistory(path string) []BrowserArtifact {
 		log("error", "history", "File not found: "+path)
 		return nil
 	}
-	var places []BrowserArtifact
 
 	// Open the database
-	db, err := sql.Open("sqlite3", path)
+	db, err := OpenDatabase(path)
 	if err != nil {
 		log("error", "history", "Error opening database: "+err.Error())
 		return nil
 	}
 	defer db.Close()
 
+	places := queryHistory(db)
+	places = append(places, RecoverFromLogs(path, places, queryHistory)...)
+	places = append(places, carveHistory(db)...)
+
+	log("info", "history", fmt.Sprintf("Found %d history entries in %s", len(places), path))
+	return places
+}
+
+func queryHistory(db *Database) []BrowserArtifact {
+	var places []BrowserArtifact
+
 	query := `SELECT history.visit_date, history.visit_type, place.url, ifnull(referrer.url,"") as referrer, ifnull(place.title,"") as title, place.visit_count, place.typed
 FROM moz_historyvisits as history
 JOIN moz_places as place ON place.id = history.place_id
@@ -134,11 +275,94 @@ LEFT JOIN moz_places as referrer ON referrer.id = referrer_history.place_id;`
 		artifact.VisitCount = row.visit_count
 		artifact.Typed = row.typed
 		artifact.TimestampType = "visit_date"
-		artifact.Timestamp = row.visit_date
+		artifact.SetTimestamp(int64(row.visit_date), EpochUnixMicroseconds)
 		artifact.HttpReferrer = row.referrer
 		places = append(places, artifact)
 	}
-	log("info", "history", fmt.Sprintf("Found %d history entries in %s", len(places), path))
+	return places
+}
+
+// carveHistory returns the places and visits deleted from the database but still found in its free space
+func carveHistory(db *Database) []BrowserArtifact {
+	var places []BrowserArtifact
+
+	// Carved visits point to places still in the database or carved as well
+	urls := map[int]string{}
+	livePlaces := map[string]bool{}
+	rows, err := db.Query("SELECT id, url FROM moz_places;")
+	if err != nil {
+		log("error", "history", "Error querying database: "+err.Error())
+		return nil
+	}
+	for rows.Next() {
+		var id int
+		var url string
+		if rows.Scan(&id, &url) == nil {
+			urls[id] = url
+			livePlaces[url] = true
+		}
+	}
+
+	liveVisits := map[string]bool{}
+	rows, err = db.Query("SELECT place_id, visit_date FROM moz_historyvisits;")
+	if err != nil {
+		log("error", "history", "Error querying database: "+err.Error())
+		return nil
+	}
+	for rows.Next() {
+		var placeID, visitDate int
+		if rows.Scan(&placeID, &visitDate) == nil {
+			liveVisits[fmt.Sprintf("%d|%d", placeID, visitDate)] = true
+		}
+	}
+
+	for _, record := range CarveRecords(db, "moz_places", "url", "title") {
+		url := record.String("url")
+		if !strings.Contains(url, ":") {
+			continue
+		}
+		if _, ok := urls[int(record.Rowid)]; record.Rowid != 0 && !ok {
+			urls[int(record.Rowid)] = url
+		}
+		if livePlaces[url] {
+			continue
+		}
+
+		artifact := BrowserArtifact{}
+		artifact.ArtifactType = "history"
+		artifact.Url = url
+		artifact.Title = record.String("title")
+		artifact.VisitCount = record.Int("visit_count")
+		artifact.Typed = record.Int("typed")
+		artifact.TimestampType = "last_visit_date"
+		if IsPRTime(int64(record.Int("last_visit_date"))) {
+			artifact.SetTimestamp(int64(record.Int("last_visit_date")), EpochUnixMicroseconds)
+		}
+		artifact.Recovery = "carved"
+		artifact.Confidence = record.Confidence
+		places = append(places, artifact)
+	}
+
+	for _, record := range CarveRecords(db, "moz_historyvisits", "place_id", "visit_date") {
+		visitDate := record.Int("visit_date")
+		if !IsPRTime(int64(visitDate)) || liveVisits[fmt.Sprintf("%d|%d", record.Int("place_id"), visitDate)] {
+			continue
+		}
+
+		artifact := BrowserArtifact{}
+		artifact.ArtifactType = "history"
+		artifact.Url = urls[record.Int("place_id")]
+		if artifact.Url == "" {
+			artifact.Metadata = fmt.Sprintf("place id %d", record.Int("place_id"))
+		}
+		artifact.TimestampType = "visit_date"
+		artifact.SetTimestamp(int64(visitDate), EpochUnixMicroseconds)
+		artifact.Recovery = "carved"
+		artifact.Confidence = record.Confidence
+		places = append(places, artifact)
+	}
+
+	log("info", "history", fmt.Sprintf("Carved %d deleted history entries", len(places)))
 	return places
 }
 
@@ -147,16 +371,25 @@ func processBookmarks(path string) []BrowserArtifact {
 		log("error", "bookmarks", "File not found: "+path)
 		return nil
 	}
-	var places []BrowserArtifact
 
 	// Open the database
-	db, err := sql.Open("sqlite3", path)
+	db, err := OpenDatabase(path)
 	if err != nil {
 		log("error", "bookmarks", "Error opening database: "+err.Error())
 		return nil
 	}
 	defer db.Close()
 
+	places := queryBookmarks(db)
+	places = append(places, RecoverFromLogs(path, places, queryBookmarks)...)
+
+	log("info", "bookmarks", fmt.Sprintf("Found %d bookmarks in %s", len(places), path))
+	return places
+}
+
+func queryBookmarks(db *Database) []BrowserArtifact {
+	var places []BrowserArtifact
+
 	query := "SELECT bookmark.title as bookmark_title, bookmark.dateAdded, bookmark.lastModified, ifnull(place.url,\"\") as url, ifnull(place.title,\"\") as title, ifnull(place.visit_count,0)\nfrom moz_bookmarks as bookmark\nLEFT JOIN moz_places as place ON bookmark.fk = place.id;"
 	type rowStruct struct {
 		bookmark_title string
@@ -187,7 +420,7 @@ func processBookmarks(path string) []BrowserArtifact {
 		artifact.VisitCount = row.visit_count
 		artifact.BookmarkTitle = row.bookmark_title
 		artifact.TimestampType = "dateAdded"
-		artifact.Timestamp = row.dateAdded
+		artifact.SetTimestamp(int64(row.dateAdded), EpochUnixMicroseconds)
 		places = append(places, artifact)
 
 		artifact = BrowserArtifact{}
@@ -197,12 +430,10 @@ func processBookmarks(path string) []BrowserArtifact {
 		artifact.VisitCount = row.visit_count
 		artifact.BookmarkTitle = row.bookmark_title
 		artifact.TimestampType = "lastModified"
-		artifact.Timestamp = row.lastModified
+		artifact.SetTimestamp(int64(row.lastModified), EpochUnixMicroseconds)
 		places = append(places, artifact)
 
 	}
-
-	log("info", "bookmarks", fmt.Sprintf("Found %d bookmarks in %s", len(places), path))
 	return places
 }
 
@@ -213,13 +444,23 @@ func processDownloads(path string) []BrowserArtifact {
 	}
 
 	// Open the database
-	db, err := sql.Open("sqlite3", path)
+	db, err := OpenDatabase(path)
 	if err != nil {
 		log("error", "downloads", "Error opening database: "+err.Error())
 		return nil
 	}
 	defer db.Close()
 
+	downloads := queryDownloads(db)
+	downloads = append(downloads, RecoverFromLogs(path, downloads, queryDownloads)...)
+
+	log("info", "downloads", fmt.Sprintf("Found %d downloads in %s", len(downloads), path))
+	return downloads
+}
+
+func queryDownloads(db *Database) []BrowserArtifact {
+	var downloads []BrowserArtifact
+
 	query := "SELECT t1.place_id, t1.content as file, t2.content as metadata, t1.flags, t1.expiration, t1.dateAdded, t1. lastModified, place.url, ifnull(place.title,\"\"), ifnull(place.description,\"\"), place.visit_count\nFROM moz_annos as t1\nLEFT JOIN moz_annos as t2 ON t1.place_id = t2.place_id\nLEFT JOIN moz_places as place ON t1.place_id = place.id\nWHERE t1.anno_attribute_id = 1;"
 	type rowStruct struct {
 		place_id     int
@@ -234,7 +475,6 @@ func processDownloads(path string) []BrowserArtifact {
 		description  string
 		visit_count  int
 	}
-	var downloads []BrowserArtifact
 
 	rows, err := db.Query(query)
 	if err != nil {
@@ -254,7 +494,7 @@ func processDownloads(path string) []BrowserArtifact {
 		artifact.Url = row.url
 		artifact.Title = row.title
 		artifact.TimestampType = "dateAdded"
-		artifact.Timestamp = row.dateAdded
+		artifact.SetTimestamp(int64(row.dateAdded), EpochUnixMicroseconds)
 		artifact.VisitCount = row.visit_count
 		artifact.Metadata = row.metadata
 		artifact.Filename = row.file
@@ -265,14 +505,12 @@ func processDownloads(path string) []BrowserArtifact {
 		artifact.Url = row.url
 		artifact.Title = row.title
 		artifact.TimestampType = "lastModified"
-		artifact.Timestamp = row.lastModified
+		artifact.SetTimestamp(int64(row.lastModified), EpochUnixMicroseconds)
 		artifact.VisitCount = row.visit_count
 		artifact.Metadata = row.metadata
 		artifact.Filename = row.file
 		downloads = append(downloads, artifact)
 	}
-
-	log("info", "downloads", fmt.Sprintf("Found %d downloads in %s", len(downloads), path))
 	return downloads
 }
 
@@ -281,16 +519,25 @@ func processFormHistory(path string) []BrowserArtifact {
 		log("error", "formhistory", "File not found: "+path)
 		return nil
 	}
-	var formHistory []BrowserArtifact
 
 	// Open the database
-	db, err := sql.Open("sqlite3", path)
+	db, err := OpenDatabase(path)
 	if err != nil {
 		log("error", "formhistory", "Error opening database: "+err.Error())
 		return nil
 	}
 	defer db.Close()
 
+	formHistory := queryFormHistory(db)
+	formHistory = append(formHistory, RecoverFromLogs(path, formHistory, queryFormHistory)...)
+
+	log("info", "formhistory", fmt.Sprintf("Found %d form history entries in %s", len(formHistory), path))
+	return formHistory
+}
+
+func queryFormHistory(db *Database) []BrowserArtifact {
+	var formHistory []BrowserArtifact
+
 	query := "SELECT fieldname, value, firstUsed, lastUsed, source FROM moz_formhistory as formhistory\nJOIN moz_history_to_sources as history2source ON formhistory.id = history2source.history_id\nJOIN moz_sources as source ON history2source.source_id = source.id;"
 
 	type rowStruct struct {
@@ -321,7 +568,7 @@ func processFormHistory(path string) []BrowserArtifact {
 		artifact.Fieldname = row.fieldname
 		artifact.Value = row.value
 		artifact.TimestampType = "firstUsed"
-		artifact.Timestamp = row.firstUsed
+		artifact.SetTimestamp(int64(row.firstUsed), EpochUnixMicroseconds)
 		formHistory = append(formHistory, artifact)
 
 		artifact = BrowserArtifact{}
@@ -330,29 +577,42 @@ func processFormHistory(path string) []BrowserArtifact {
 		artifact.Fieldname = row.fieldname
 		artifact.Value = row.value
 		artifact.TimestampType = "lastUsed"
-		artifact.Timestamp = row.lastUsed
+		artifact.SetTimestamp(int64(row.lastUsed), EpochUnixMicroseconds)
 		formHistory = append(formHistory, artifact)
 
 	}
-
-	log("info", "formhistory", fmt.Sprintf("Found %d form history entries in %s", len(formHistory), path))
 	return formHistory
 }
 
-func processCookies(path string) []BrowserArtifact {
+func processCookies(path string, emit Emit) {
 	if CheckPath(path, false) == false {
 		log("error", "cookies", "File not found: "+path)
-		return nil
+		return
 	}
-	var cookies []BrowserArtifact
 
-	db, err := sql.Open("sqlite3", path)
+	db, err := OpenDatabase(path)
 	if err != nil {
 		log("error", "cookies", "Error opening database: "+err.Error())
-		return nil
+		return
 	}
 	defer db.Close()
 
+	count := 0
+	counted := func(artifact BrowserArtifact) {
+		count++
+		emit(artifact)
+	}
+	reported, tracked := TrackReported(path, counted)
+	queryCookies(db, tracked)
+	for _, artifact := range RecoverReported(path, reported, CollectQuery(queryCookies)) {
+		counted(artifact)
+	}
+
+	log("info", "cookies", fmt.Sprintf("Found %d cookies in %s", count, path))
+}
+
+func queryCookies(db *Database, emit Emit) {
+
 	query := "SELECT host, name, value, path, expiry, lastAccessed, creationTime FROM moz_cookies;"
 	type rowStruct struct {
 		host         string
@@ -367,8 +627,9 @@ func processCookies(path string) []BrowserArtifact {
 	rows, err := db.Query(query)
 	if err != nil {
 		log("error", "cookies", "Error querying database: "+err.Error())
-		return nil
+		return
 	}
+	defer rows.Close()
 	for rows.Next() {
 		row := rowStruct{}
 		err = rows.Scan(&row.host, &row.name, &row.value, &row.path, &row.expiry, &row.lastAccessed, &row.creationTime)
@@ -382,20 +643,17 @@ func processCookies(path string) []BrowserArtifact {
 		artifact.Url = row.host
 		artifact.Cookie = row.name + "=" + row.value
 		artifact.TimestampType = "creationTime"
-		artifact.Timestamp = row.creationTime
-		cookies = append(cookies, artifact)
+		artifact.SetTimestamp(int64(row.creationTime), EpochUnixMicroseconds)
+		emit(artifact)
 
 		artifact = BrowserArtifact{}
 		artifact.ArtifactType = "cookie"
 		artifact.Url = row.host
 		artifact.Cookie = row.name + "=" + row.value
 		artifact.TimestampType = "lastAccessed"
-		artifact.Timestamp = row.lastAccessed
-		cookies = append(cookies, artifact)
+		artifact.SetTimestamp(int64(row.lastAccessed), EpochUnixMicroseconds)
+		emit(artifact)
 	}
-
-	log("info", "cookies", fmt.Sprintf("Found %d cookies in %s", len(cookies), path))
-	return cookies
 }
 
 /*
@@ -406,7 +664,7 @@ Thanks to James Habben
 func parseCacheFile(filename string) (error, []BrowserArtifact) {
 	artifacts := make([]BrowserArtifact, 0)
 
-	file, err := os.Open(filename)
+	file, err := TargetOpen(filename)
 	if err != nil {
 		return err, nil
 	}
@@ -479,8 +737,7 @@ func parseCacheFile(filename string) (error, []BrowserArtifact) {
 	lastFetchArtifact := BrowserArtifact{}
 	lastFetchArtifact.ArtifactType = "cache"
 	lastFetchArtifact.Url = string(key)
-	// Convert sec to microsec
-	lastFetchArtifact.Timestamp = int(lastFetchInt) * 1000 * 1000
+	lastFetchArtifact.SetTimestamp(int64(lastFetchInt), EpochUnixSeconds)
 	lastFetchArtifact.VisitCount = int(fetchCount)
 
 	if lastFetchInt == lastModInt {
@@ -490,7 +747,7 @@ func parseCacheFile(filename string) (error, []BrowserArtifact) {
 		lastModArtifact.ArtifactType = "cache"
 		lastModArtifact.Url = string(key)
 		lastModArtifact.TimestampType = "lastMod"
-		lastModArtifact.Timestamp = int(lastModInt)
+		lastModArtifact.SetTimestamp(int64(lastModInt), EpochUnixSeconds)
 		lastModArtifact.VisitCount = int(fetchCount)
 		artifacts = append(artifacts, lastModArtifact)
 	}
@@ -499,35 +756,41 @@ func parseCacheFile(filename string) (error, []BrowserArtifact) {
 	return nil, artifacts
 }
 
-func processCache(path string) []BrowserArtifact {
+func processCache(path string, emit Emit) {
 	if CheckPath(path, true) == false {
 		log("error", "cache", "Directory not found: "+path)
-		return nil
+		return
 	}
-	var cache []BrowserArtifact
 
 	// List all files in the cache directory
-	dir, err := os.ReadDir(path + "entries")
+	dir, err := TargetReadDir(filepath.Join(path, "entries"))
 	if err != nil {
 		log("error", "cache", "Error reading cache directory: "+err.Error())
-		return nil
+		return
 	}
 
-	for _, entry := range dir {
-		if entry.IsDir() {
-			continue
+	var files []string
+	for _, file := range dir {
+		if !file.IsDir() {
+			files = append(files, filepath.Join(path, "entries", file.Name()))
 		}
+	}
 
-		err, artifacts := parseCacheFile(path + "entries/" + entry.Name())
+	// Thousands of entry files, parsed on Workers goroutines and emitted in directory order
+	count := 0
+	StreamParallel(len(files), func(i int) []BrowserArtifact {
+		err, artifacts := parseCacheFile(files[i])
 		if err != nil {
 			log("error", "cache", "Error parsing cache file: "+err.Error())
-			continue
+			return nil
 		}
-		cache = append(cache, artifacts...)
-	}
+		return artifacts
+	}, func(artifact BrowserArtifact) {
+		count++
+		emit(artifact)
+	})
 
-	log("info", "cache", fmt.Sprintf("Found %d cache entries in %s", len(cache), path))
-	return cache
+	log("info", "cache", fmt.Sprintf("Found %d cache entries in %s", count, path))
 }
 
 func processFavicons(path string) []BrowserArtifact {
@@ -535,16 +798,25 @@ func processFavicons(path string) []BrowserArtifact {
 		log("error", "favicons", "File not found: "+path)
 		return nil
 	}
-	var favicons []BrowserArtifact
 
 	// Open the database
-	db, err := sql.Open("sqlite3", path)
+	db, err := OpenDatabase(path)
 	if err != nil {
 		log("error", "favicons", "Error opening database: "+err.Error())
 		return nil
 	}
 	defer db.Close()
 
+	favicons := queryFavicons(db)
+	favicons = append(favicons, RecoverFromLogs(path, favicons, queryFavicons)...)
+
+	log("info", "favicons", fmt.Sprintf("Found %d favicons in %s", len(favicons), path))
+	return favicons
+}
+
+func queryFavicons(db *Database) []BrowserArtifact {
+	var favicons []BrowserArtifact
+
 	query := "SELECT icon_url, expire_ms FROM moz_icons;"
 	type rowStruct struct {
 		icon_url string
@@ -569,13 +841,9 @@ func processFavicons(path string) []BrowserArtifact {
 		artifact.ArtifactType = "favicon"
 		artifact.Url = row.icon_url
 		artifact.TimestampType = "expires -7 days (favicons)"
-		artifact.Timestamp = row.expires - 7*24*60*60*1000
-		// Convert milliseconds to microseconds
-		artifact.Timestamp = artifact.Timestamp * 1000
+		artifact.SetTimestamp(int64(row.expires-7*24*60*60*1000), EpochUnixMilliseconds)
 		favicons = append(favicons, artifact)
 	}
-
-	log("info", "favicons", fmt.Sprintf("Found %d favicons in %s", len(favicons), path))
 	return favicons
 }
 
@@ -587,7 +855,7 @@ func processLogins(path string) []BrowserArtifact {
 	var logins []BrowserArtifact
 
 	// Open JSON file
-	file, err := os.Open(path)
+	file, err := TargetOpen(path)
 	if err != nil {
 		log("error", "logins", "Error opening file: "+err.Error())
 		return nil
@@ -608,27 +876,21 @@ func processLogins(path string) []BrowserArtifact {
 		artifact.Url = login.Hostname
 		artifact.ArtifactType = "login"
 		artifact.TimestampType = "dateCreated"
-		artifact.Timestamp = int(login.TimeCreated)
-		// Convert milliseconds to microseconds
-		artifact.Timestamp = artifact.Timestamp * 1000
+		artifact.SetTimestamp(int64(login.TimeCreated), EpochUnixMilliseconds)
 		logins = append(logins, artifact)
 
 		artifact = BrowserArtifact{}
 		artifact.Url = login.Hostname
 		artifact.ArtifactType = "login"
 		artifact.TimestampType = "dateLastUsed"
-		artifact.Timestamp = int(login.TimeLastUsed)
-		// Convert milliseconds to microseconds
-		artifact.Timestamp = artifact.Timestamp * 1000
+		artifact.SetTimestamp(int64(login.TimeLastUsed), EpochUnixMilliseconds)
 		logins = append(logins, artifact)
 
 		artifact = BrowserArtifact{}
 		artifact.ArtifactType = "login"
 		artifact.Url = login.Hostname
 		artifact.TimestampType = "datePasswordChanged"
-		artifact.Timestamp = int(login.TimePasswordChanged)
-		// Convert milliseconds to microseconds
-		artifact.Timestamp = artifact.Timestamp * 1000
+		artifact.SetTimestamp(int64(login.TimePasswordChanged), EpochUnixMilliseconds)
 		logins = append(logins, artifact)
 	}
 
@@ -644,7 +906,7 @@ func processAddons(path string) []BrowserArtifact {
 	var addons []BrowserArtifact
 
 	// Open JSON file
-	file, err := os.Open(path)
+	file, err := TargetOpen(path)
 	if err != nil {
 		log("error", "addons", "Error opening file: "+err.Error())
 		return nil
@@ -676,9 +938,7 @@ func processAddons(path string) []BrowserArtifact {
 		artifact.AverageRating = float32(addon.AverageRating)
 		artifact.RatingCount = addon.ReviewCount
 		artifact.TimestampType = "updateDate"
-		artifact.Timestamp = int(addon.UpdateDate)
-		// Convert milliseconds to microseconds
-		artifact.Timestamp = artifact.Timestamp * 1000
+		artifact.SetTimestamp(int64(addon.UpdateDate), EpochUnixMilliseconds)
 		addons = append(addons, artifact)
 	}
 
@@ -694,7 +954,7 @@ func processExtensions(path string) []BrowserArtifact {
 	var extensions []BrowserArtifact
 
 	// Open JSON file
-	file, err := os.Open(path)
+	file, err := TargetOpen(path)
 	if err != nil {
 		log("error", "extensions", "Error opening file: "+err.Error())
 		return nil
@@ -727,8 +987,7 @@ func processExtensions(path string) []BrowserArtifact {
 		artifact.SourceURI = addon.SourceURI
 		artifact.Url = addon.RootURI
 		artifact.TimestampType = "updateDate"
-		// Convert milliseconds to nanoseconds
-		artifact.Timestamp = int(addon.UpdateDate) * 1000
+		artifact.SetTimestamp(int64(addon.UpdateDate), EpochUnixMilliseconds)
 		extensions = append(extensions, artifact)
 
 		artifact = BrowserArtifact{}
@@ -747,20 +1006,19 @@ func processExtensions(path string) []BrowserArtifact {
 		artifact.SourceURI = addon.SourceURI
 		artifact.Url = addon.RootURI
 		artifact.TimestampType = "installDate"
-		artifact.Timestamp = int(addon.InstallDate)
+		artifact.SetTimestamp(int64(addon.InstallDate), EpochUnixMilliseconds)
+		extensions = append(extensions, artifact)
 	}
 
 	log("info", "extensions", fmt.Sprintf("Found %d extensions in %s", len(extensions), path))
 	return extensions
 }
 
-func parseBookmarkBackupFile(path string) (error, []BrowserArtifact) {
-
-	artifacts := []BrowserArtifact{}
-
-	file, err := os.Open(path)
+// readMozLz4 decompresses a mozLz4 file: "mozLz40\0" magic, uint32 uncompressed size, LZ4 block
+func readMozLz4(path string) ([]byte, error) {
+	file, err := TargetOpen(path)
 	if err != nil {
-		return err, nil
+		return nil, err
 	}
 	defer file.Close()
 
@@ -768,41 +1026,109 @@ func parseBookmarkBackupFile(path string) (error, []BrowserArtifact) {
 	header := make([]byte, 8)
 	_, err = io.ReadFull(file, header)
 	if err != nil {
-		return err, nil
+		return nil, err
 	}
 
 	// Verify the header format (expect "mozLz40\x00")
 	expectedHeader := []byte("mozLz40\x00")
 	if !bytes.Equal(header[:8], expectedHeader) {
-		return err, nil
+		return nil, errors.New("invalid mozLz4 header")
 	}
 
 	// Read the uncompressed size (4 bytes, little-endian)
 	var size uint32
 	err = binary.Read(file, binary.LittleEndian, &size)
 	if err != nil {
-		return err, nil
+		return nil, err
 	}
 
-	// Create a buffer to store the LZ4 block
-	lz4Block := make([]byte, size)
-	_, err = io.ReadFull(file, lz4Block)
-	if err != nil && err != io.ErrUnexpectedEOF {
-		return err, nil
+	// Read the LZ4 block
+	lz4Block, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
 	}
 
 	// Decompress the LZ4 block
 	decompressedData := make([]byte, size)
-	_, err = lz4.UncompressBlock(lz4Block, decompressedData)
+	n, err := lz4.UncompressBlock(lz4Block, decompressedData)
+	if err != nil {
+		return nil, err
+	}
+
+	return decompressedData[:n], nil
+}
+
+func parseBookmarkBackupFile(path string) (error, []BrowserArtifact) {
+	var data []byte
+	var err error
+	if strings.HasSuffix(path, ".jsonlz4") {
+		data, err = readMozLz4(path)
+	} else {
+		data, err = TargetReadFile(path)
+	}
+	if err != nil {
+		return err, nil
+	}
+
+	var root bookmarkBackupNode
+	err = json.Unmarshal(data, &root)
 	if err != nil {
 		return err, nil
 	}
 
+	// Backups are named bookmarks-YYYY-MM-DD_<count>_<hash>.jsonlz4
+	backupDate := ""
+	if match := regexp.MustCompile(`bookmarks-(\d{4}-\d{2}-\d{2})`).FindStringSubmatch(filepath.Base(path)); match != nil {
+		backupDate = match[1]
+	}
+
+	// The places root itself is not part of the folder path
+	var artifacts []BrowserArtifact
+	for _, child := range root.Children {
+		artifacts = append(artifacts, walkBookmarkBackup(child, "", backupDate)...)
+	}
 	return nil, artifacts
 }
 
+// walkBookmarkBackup returns the bookmarks of a backup tree, keeping the folder path of each one
+func walkBookmarkBackup(node bookmarkBackupNode, folder string, backupDate string) []BrowserArtifact {
+	var artifacts []BrowserArtifact
+
+	if node.URI != "" {
+		artifact := BrowserArtifact{}
+		artifact.ArtifactType = "bookmark"
+		artifact.Url = node.URI
+		artifact.BookmarkTitle = node.Title
+		artifact.BookmarkFolder = folder
+		artifact.BackupDate = backupDate
+		artifact.TimestampType = "dateAdded (backup)"
+		artifact.SetTimestamp(node.DateAdded, EpochUnixMicroseconds)
+		artifacts = append(artifacts, artifact)
+
+		artifact.TimestampType = "lastModified (backup)"
+		artifact.SetTimestamp(node.LastModified, EpochUnixMicroseconds)
+		artifacts = append(artifacts, artifact)
+	}
+
+	if len(node.Children) > 0 {
+		// Root folders have no title in recent versions, use their root name instead (toolbarFolder...)
+		name := node.Title
+		if name == "" {
+			name = node.Root
+		}
+		path := folder
+		if name != "" {
+			path = folder + "/" + name
+		}
+		for _, child := range node.Children {
+			artifacts = append(artifacts, walkBookmarkBackup(child, path, backupDate)...)
+		}
+	}
+
+	return artifacts
+}
+
 func processBookmarksBackup(path string) []BrowserArtifact {
-	log("debug", "bookmarks", "Not implemented yet")
 	// Check if the profile has bookmarkbackups
 	if CheckPath(path, true) == false {
 		log("error", "bookmarks", "Directory not found: "+path)
@@ -810,28 +1136,32 @@ func processBookmarksBackup(path string) []BrowserArtifact {
 	}
 
 	var bookmarks []BrowserArtifact
-	/*
-		// List all files in the bookmarkbackups directory
-		dir, err := os.ReadDir(path)
-		if err != nil {
-			return nil
-		}
 
-		// Loop through all files in the bookmarkbackups directory
-		for _, entry := range dir {
-			if entry.IsDir() {
-				continue
-			}
+	// List all files in the bookmarkbackups directory
+	dir, err := TargetReadDir(path)
+	if err != nil {
+		log("error", "bookmarks", "Error reading bookmark backups directory: "+err.Error())
+		return nil
+	}
 
-			// Files are in JSONLZ4 format
-			// Open the file
-			err, artifacts := parseBookmarkBackupFile(path + "/" + entry.Name())
-			if err != nil {
-				continue
-			}
-			bookmarks = append(bookmarks, artifacts...)
+	// Loop through all files in the bookmarkbackups directory
+	for _, entry := range dir {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), "bookmarks-") {
+			continue
+		}
+		if !strings.HasSuffix(entry.Name(), ".jsonlz4") && !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
 
+		// Files are in JSONLZ4 format, older ones in plain JSON
+		err, artifacts := parseBookmarkBackupFile(filepath.Join(path, entry.Name()))
+		if err != nil {
+			log("error", "bookmarks", "Error parsing bookmark backup "+entry.Name()+": "+err.Error())
+			continue
 		}
-	*/
+		bookmarks = append(bookmarks, artifacts...)
+	}
+
+	log("info", "bookmarks", fmt.Sprintf("Found %d bookmarks in backups of %s", len(bookmarks), path))
 	return bookmarks
 }
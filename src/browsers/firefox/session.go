@@ -0,0 +1,214 @@
+package firefox
+
+import (
+	"encoding/json"
+	"fmt"
+	. "local/BrowserArtifact/src"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+/*
+Session restore files are mozLz4 compressed JSON:
+  - sessionstore.jsonlz4: session saved at the last clean shutdown
+  - sessionstore-backups/recovery.jsonlz4, recovery.baklz4: session being written while the browser runs
+  - sessionstore-backups/previous.jsonlz4: session before the last one
+  - sessionstore-backups/upgrade.jsonlz4-<build id>: session saved before a browser upgrade
+*/
+
+func init() {
+	// The session files are looked for in the profile directory, only they are collected
+	RegisterExtractor(FileExtractor{ExtractorName: "firefox_session", Family: "firefox", Types: "session, session_formdata, session_cookie", LocateFunc: profileFile(), ExtractFunc: processSession,
+		SourcesFunc: func(profile Profile) []string {
+			return getSessionFiles(profile.Path)
+		}})
+}
+
+// getSessionFiles lists the session restore files of a profile
+func getSessionFiles(path string) []string {
+	files := []string{}
+	if CheckPath(filepath.Join(path, "sessionstore.jsonlz4"), false) {
+		files = append(files, filepath.Join(path, "sessionstore.jsonlz4"))
+	}
+
+	dir, err := TargetReadDir(filepath.Join(path, "sessionstore-backups"))
+	if err != nil {
+		return files
+	}
+	for _, entry := range dir {
+		name := entry.Name()
+		if entry.IsDir() {
+			continue
+		}
+		if name == "recovery.jsonlz4" || name == "recovery.baklz4" || name == "previous.jsonlz4" || strings.HasPrefix(name, "upgrade.jsonlz4") {
+			files = append(files, filepath.Join(path, "sessionstore-backups", name))
+		}
+	}
+	return files
+}
+
+func processSession(path string) []BrowserArtifact {
+	files := getSessionFiles(path)
+	if len(files) == 0 {
+		log("error", "session", "No session file found in: "+path)
+		return nil
+	}
+
+	var artifacts []BrowserArtifact
+	for _, file := range files {
+		data, err := readMozLz4(file)
+		if err != nil {
+			log("error", "session", "Error decompressing session file "+file+": "+err.Error())
+			continue
+		}
+
+		var session sessionJSON
+		err = json.Unmarshal(data, &session)
+		if err != nil {
+			log("error", "session", "Error parsing JSON: "+err.Error())
+			continue
+		}
+		artifacts = append(artifacts, sessionArtifacts(filepath.Base(file), session)...)
+	}
+
+	log("info", "session", fmt.Sprintf("Found %d session entries in %s", len(artifacts), path))
+	return artifacts
+}
+
+func sessionArtifacts(source string, session sessionJSON) []BrowserArtifact {
+	var artifacts []BrowserArtifact
+
+	// Windows of the session are numbered from 1, closed windows follow the open ones
+	windows := append(session.Windows, session.ClosedWindows...)
+	for i, window := range windows {
+		windowIndex := i + 1
+		windowClosed := i >= len(session.Windows)
+
+		tabIndex := 0
+		for _, tab := range window.Tabs {
+			tabIndex++
+			action := "open"
+			if windowClosed {
+				action = "closed"
+			}
+			artifacts = append(artifacts, tabArtifacts(source, windowIndex, tabIndex, tab, action)...)
+		}
+		for _, closedTab := range window.ClosedTabs {
+			tabIndex++
+			artifacts = append(artifacts, tabArtifacts(source, windowIndex, tabIndex, closedTab.State, "closed")...)
+
+			artifact := BrowserArtifact{}
+			artifact.ArtifactType = "session"
+			artifact.Action = "tab_closed"
+			if entry, ok := selectedEntry(closedTab.State); ok {
+				artifact.Url = entry.URL
+				artifact.Title = entry.Title
+				artifact.NavigationIndex = closedTab.State.Index - 1
+			}
+			artifact.SessionWindow = windowIndex
+			artifact.SessionTab = tabIndex
+			artifact.TimestampType = "closedAt (" + source + ")"
+			artifact.SetTimestamp(int64(closedTab.ClosedAt), EpochUnixMilliseconds)
+			artifacts = append(artifacts, artifact)
+		}
+
+		if window.ClosedAt != 0 {
+			artifact := BrowserArtifact{}
+			artifact.ArtifactType = "session"
+			artifact.Action = "window_closed"
+			artifact.SessionWindow = windowIndex
+			artifact.TimestampType = "closedAt (" + source + ")"
+			artifact.SetTimestamp(int64(window.ClosedAt), EpochUnixMilliseconds)
+			artifacts = append(artifacts, artifact)
+		}
+
+		artifacts = append(artifacts, cookieArtifacts(source, session, window.Cookies)...)
+	}
+	artifacts = append(artifacts, cookieArtifacts(source, session, session.Cookies)...)
+
+	return artifacts
+}
+
+// selectedEntry returns the entry displayed by a tab, index is 1-based
+func selectedEntry(tab sessionTabJSON) (sessionEntryJSON, bool) {
+	if tab.Index < 1 || tab.Index > len(tab.Entries) {
+		return sessionEntryJSON{}, false
+	}
+	return tab.Entries[tab.Index-1], true
+}
+
+// tabArtifacts returns the back/forward entries of a tab and the form data they hold
+func tabArtifacts(source string, windowIndex int, tabIndex int, tab sessionTabJSON, action string) []BrowserArtifact {
+	var artifacts []BrowserArtifact
+
+	for i, entry := range tab.Entries {
+		artifact := BrowserArtifact{}
+		artifact.ArtifactType = "session"
+		artifact.Action = action
+		artifact.Url = entry.URL
+		artifact.Title = entry.Title
+		artifact.HttpReferrer = entry.Referrer
+		artifact.SessionWindow = windowIndex
+		artifact.SessionTab = tabIndex
+		artifact.NavigationIndex = i
+		artifact.TimestampType = "lastAccessed (" + source + ")"
+		artifact.SetTimestamp(int64(tab.LastAccessed), EpochUnixMilliseconds)
+		artifacts = append(artifacts, artifact)
+
+		artifacts = append(artifacts, formDataArtifacts(entry, artifact)...)
+	}
+
+	return artifacts
+}
+
+// formDataArtifacts returns the form fields captured in an entry and its frames
+func formDataArtifacts(entry sessionEntryJSON, parent BrowserArtifact) []BrowserArtifact {
+	var artifacts []BrowserArtifact
+
+	if entry.FormData != nil {
+		url := entry.FormData.URL
+		if url == "" {
+			url = entry.URL
+		}
+		for _, fields := range []map[string]interface{}{entry.FormData.ID, entry.FormData.XPath} {
+			// Map iteration order is random, keep output stable
+			names := make([]string, 0, len(fields))
+			for name := range fields {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			for _, name := range names {
+				artifact := parent
+				artifact.ArtifactType = "session_formdata"
+				artifact.Url = url
+				artifact.Fieldname = name
+				artifact.Value = fmt.Sprint(fields[name])
+				artifacts = append(artifacts, artifact)
+			}
+		}
+	}
+
+	for _, child := range entry.Children {
+		artifacts = append(artifacts, formDataArtifacts(child, parent)...)
+	}
+
+	return artifacts
+}
+
+func cookieArtifacts(source string, session sessionJSON, cookies []sessionCookieJSON) []BrowserArtifact {
+	var artifacts []BrowserArtifact
+
+	for _, cookie := range cookies {
+		artifact := BrowserArtifact{}
+		artifact.ArtifactType = "session_cookie"
+		artifact.Url = cookie.Host
+		artifact.Cookie = cookie.Name + "=" + cookie.Value
+		artifact.TimestampType = "lastUpdate (" + source + ")"
+		artifact.SetTimestamp(int64(session.Session.LastUpdate), EpochUnixMilliseconds)
+		artifacts = append(artifacts, artifact)
+	}
+
+	return artifacts
+}
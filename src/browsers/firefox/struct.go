@@ -1,5 +1,18 @@
 package firefox
 
+type iniSection struct {
+	Name   string
+	Values map[string]string
+}
+
+type firefoxProfile struct {
+	Name        string
+	Path        string
+	LocalPath   string
+	IsDefault   bool
+	InstallHash string
+}
+
 type loginJSON struct {
 	NextID int `json:"nextId"`
 	Logins []struct {
@@ -153,3 +166,66 @@ type extensionJSON struct {
 		Location            string      `json:"location"`
 	} `json:"addons"`
 }
+
+type sessionJSON struct {
+	Session struct {
+		LastUpdate int64 `json:"lastUpdate"`
+		StartTime  int64 `json:"startTime"`
+	} `json:"session"`
+	Windows       []sessionWindowJSON `json:"windows"`
+	ClosedWindows []sessionWindowJSON `json:"_closedWindows"`
+	Cookies       []sessionCookieJSON `json:"cookies"`
+}
+
+type sessionWindowJSON struct {
+	Tabs       []sessionTabJSON `json:"tabs"`
+	ClosedTabs []struct {
+		State    sessionTabJSON `json:"state"`
+		ClosedAt int64          `json:"closedAt"`
+		Title    string         `json:"title"`
+	} `json:"_closedTabs"`
+	Selected int                 `json:"selected"`
+	ClosedAt int64               `json:"closedAt"`
+	Cookies  []sessionCookieJSON `json:"cookies"`
+}
+
+type sessionTabJSON struct {
+	Entries      []sessionEntryJSON `json:"entries"`
+	Index        int                `json:"index"`
+	LastAccessed int64              `json:"lastAccessed"`
+}
+
+type sessionEntryJSON struct {
+	URL         string `json:"url"`
+	Title       string `json:"title"`
+	Referrer    string `json:"referrer"`
+	OriginalURI string `json:"originalURI"`
+	FormData    *struct {
+		URL   string                 `json:"url"`
+		ID    map[string]interface{} `json:"id"`
+		XPath map[string]interface{} `json:"xpath"`
+	} `json:"formdata"`
+	Children []sessionEntryJSON `json:"children"`
+}
+
+type sessionCookieJSON struct {
+	Host   string `json:"host"`
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Path   string `json:"path"`
+	Expiry int64  `json:"expiry"`
+}
+
+type bookmarkBackupNode struct {
+	GUID         string               `json:"guid"`
+	Title        string               `json:"title"`
+	Index        int                  `json:"index"`
+	DateAdded    int64                `json:"dateAdded"`
+	LastModified int64                `json:"lastModified"`
+	ID           int                  `json:"id"`
+	TypeCode     int                  `json:"typeCode"`
+	Type         string               `json:"type"`
+	Root         string               `json:"root"`
+	URI          string               `json:"uri"`
+	Children     []bookmarkBackupNode `json:"children"`
+}
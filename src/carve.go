@@ -0,0 +1,541 @@
+package src
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+/**
+ * Carving of deleted records from the free space of a SQLite database:
+ * - pages on the freelist, whose former cells are parsed when the page still looks like a table leaf page
+ * - freeblocks and unallocated space of table leaf pages
+ * Candidate records are matched against the schema of the table read from the database itself: column count,
+ * declared types and the NULL stored in place of an INTEGER PRIMARY KEY.
+ * Confidence of a carved record:
+ * - high: intact cell of a table leaf page on the freelist
+ * - medium: complete record found in a freeblock or unallocated space
+ * - low: record whose header was partly overwritten, or truncated by the end of the page
+ */
+
+type CarvedRecord struct {
+	Table      string
+	Rowid      int64 // 0 when the cell header was lost
+	Values     map[string]interface{}
+	Confidence string
+}
+
+type carveColumn struct {
+	name    string
+	kind    string // integer, text, real, blob, numeric
+	notNull bool
+	rowid   bool
+}
+
+type carveTable struct {
+	name       string
+	columns    []carveColumn
+	minColumns int
+}
+
+type sqliteFile struct {
+	data     []byte
+	pageSize int
+	usable   int
+	pages    int
+}
+
+var confidenceRank = map[string]int{"low": 1, "medium": 2, "high": 3}
+
+// CarveRecords returns the deleted records of table holding at least the given columns
+func CarveRecords(db *Database, table string, columns ...string) []CarvedRecord {
+	if !RecoverRecords {
+		return nil
+	}
+
+	schema, err := readCarveTable(db, table, columns)
+	if err != nil {
+		Log.Log("debug", "src", "carve", "Error reading schema of "+table+": "+err.Error())
+		return nil
+	}
+
+	file, err := readSQLiteFile(db.path)
+	if err != nil {
+		Log.Log("debug", "src", "carve", "Error reading "+db.path+": "+err.Error())
+		return nil
+	}
+
+	var records []CarvedRecord
+	free := file.freelist()
+	for page := 1; page <= file.pages; page++ {
+		if free[page] {
+			records = append(records, file.carveFreePage(page, schema)...)
+		} else if file.pageType(page) == 0x0d {
+			records = append(records, file.carveLeafFreeSpace(page, schema)...)
+		}
+	}
+
+	// The same record is often found several times, e.g. a stale copy left by a page split
+	best := map[string]int{}
+	var carved []CarvedRecord
+	for _, record := range records {
+		key := fmt.Sprintf("%v", record.Values)
+		if i, ok := best[key]; ok {
+			if confidenceRank[record.Confidence] > confidenceRank[carved[i].Confidence] {
+				carved[i] = record
+			}
+			continue
+		}
+		best[key] = len(carved)
+		carved = append(carved, record)
+	}
+
+	Log.Log("debug", "src", "carve", fmt.Sprintf("Carved %d %s records from %s", len(carved), table, db.path))
+	return carved
+}
+
+func readCarveTable(db *Database, table string, required []string) (carveTable, error) {
+	schema := carveTable{name: table}
+
+	rows, err := db.Query("SELECT name, type, \"notnull\", pk FROM pragma_table_info(?)", table)
+	if err != nil {
+		return schema, err
+	}
+	defer rows.Close()
+
+	primaryKeys := 0
+	for rows.Next() {
+		var name, declared string
+		var notNull, pk int
+		err = rows.Scan(&name, &declared, &notNull, &pk)
+		if err != nil {
+			return schema, err
+		}
+		column := carveColumn{name: name, kind: columnAffinity(declared), notNull: notNull == 1}
+		column.rowid = pk == 1 && strings.EqualFold(declared, "INTEGER")
+		if pk > 0 {
+			primaryKeys++
+		}
+		schema.columns = append(schema.columns, column)
+	}
+	if len(schema.columns) == 0 {
+		return schema, fmt.Errorf("table %s not found", table)
+	}
+	if primaryKeys > 1 {
+		for i := range schema.columns {
+			schema.columns[i].rowid = false
+		}
+	}
+
+	// Rows written before an ALTER TABLE ADD COLUMN hold fewer columns
+	schema.minColumns = 1
+	for i, column := range schema.columns {
+		for _, name := range required {
+			if column.name == name && i+1 > schema.minColumns {
+				schema.minColumns = i + 1
+			}
+		}
+	}
+	return schema, nil
+}
+
+// columnAffinity applies the SQLite rules to a declared column type
+func columnAffinity(declared string) string {
+	declared = strings.ToUpper(declared)
+	switch {
+	case strings.Contains(declared, "INT"):
+		return "integer"
+	case strings.Contains(declared, "CHAR"), strings.Contains(declared, "CLOB"), strings.Contains(declared, "TEXT"):
+		return "text"
+	case declared == "", strings.Contains(declared, "BLOB"):
+		return "blob"
+	case strings.Contains(declared, "REAL"), strings.Contains(declared, "FLOA"), strings.Contains(declared, "DOUB"):
+		return "real"
+	}
+	return "numeric"
+}
+
+// compatible tells if a serial type can be stored in a column
+func (c carveColumn) compatible(serialType uint64) bool {
+	if serialType == 10 || serialType == 11 {
+		return false
+	}
+	if c.rowid {
+		return serialType == 0
+	}
+	if serialType == 0 {
+		return !c.notNull
+	}
+	isText := serialType >= 13 && serialType%2 == 1
+	isBlob := serialType >= 12 && serialType%2 == 0
+	switch c.kind {
+	case "integer", "real":
+		return !isText && !isBlob
+	case "text":
+		return isText
+	case "numeric":
+		return !isBlob
+	}
+	return true
+}
+
+func readSQLiteFile(path string) (*sqliteFile, error) {
+	data, err := TargetReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 100 || string(data[:16]) != "SQLite format 3\x00" {
+		return nil, fmt.Errorf("not a SQLite database")
+	}
+	file := &sqliteFile{data: data}
+	file.pageSize = int(binary.BigEndian.Uint16(data[16:18]))
+	if file.pageSize == 1 {
+		file.pageSize = 65536
+	}
+	if file.pageSize < 512 {
+		return nil, fmt.Errorf("invalid page size %d", file.pageSize)
+	}
+	file.usable = file.pageSize - int(data[20])
+	file.pages = len(data) / file.pageSize
+	return file, nil
+}
+
+func (f *sqliteFile) page(number int) []byte {
+	return f.data[(number-1)*f.pageSize : number*f.pageSize][:f.usable]
+}
+
+// headerOffset is the offset of the b-tree page header, page 1 starts with the database header
+func headerOffset(number int) int {
+	if number == 1 {
+		return 100
+	}
+	return 0
+}
+
+func (f *sqliteFile) pageType(number int) byte {
+	return f.page(number)[headerOffset(number)]
+}
+
+// freelist returns the trunk and leaf pages of the freelist
+func (f *sqliteFile) freelist() map[int]bool {
+	free := map[int]bool{}
+	trunk := int(binary.BigEndian.Uint32(f.data[32:36]))
+	for trunk > 0 && trunk <= f.pages && !free[trunk] {
+		free[trunk] = true
+		page := f.page(trunk)
+		count := int(binary.BigEndian.Uint32(page[4:8]))
+		for i := 0; i < count && 8+4*i+4 <= len(page); i++ {
+			leaf := int(binary.BigEndian.Uint32(page[8+4*i:]))
+			if leaf > 0 && leaf <= f.pages {
+				free[leaf] = true
+			}
+		}
+		trunk = int(binary.BigEndian.Uint32(page[0:4]))
+	}
+	return free
+}
+
+func (f *sqliteFile) carveFreePage(number int, table carveTable) []CarvedRecord {
+	page := f.page(number)
+	if f.pageType(number) != 0x0d {
+		// Trunk pages and pages of other kinds are scanned as a whole
+		return scanRecords(page, 0, len(page), table, false)
+	}
+
+	var records []CarvedRecord
+	offset := headerOffset(number)
+	cells := int(binary.BigEndian.Uint16(page[offset+3:]))
+	for i := 0; i < cells; i++ {
+		pointer := offset + 8 + 2*i
+		if pointer+2 > len(page) {
+			break
+		}
+		if record, ok := f.parseCell(page, int(binary.BigEndian.Uint16(page[pointer:])), table); ok {
+			records = append(records, record)
+		}
+	}
+	return append(records, f.carveLeafFreeSpace(number, table)...)
+}
+
+// carveLeafFreeSpace scans the unallocated space and the freeblocks of a table leaf page
+func (f *sqliteFile) carveLeafFreeSpace(number int, table carveTable) []CarvedRecord {
+	page := f.page(number)
+	offset := headerOffset(number)
+	cells := int(binary.BigEndian.Uint16(page[offset+3:]))
+	contentStart := int(binary.BigEndian.Uint16(page[offset+5:]))
+	if contentStart == 0 {
+		contentStart = 65536
+	}
+	if contentStart > len(page) {
+		contentStart = len(page)
+	}
+
+	records := scanRecords(page, offset+8+2*cells, contentStart, table, false)
+
+	visited := map[int]bool{}
+	freeblock := int(binary.BigEndian.Uint16(page[offset+1:]))
+	for freeblock > 0 && freeblock+4 <= len(page) && !visited[freeblock] {
+		visited[freeblock] = true
+		size := int(binary.BigEndian.Uint16(page[freeblock+2:]))
+		end := freeblock + size
+		if end > len(page) {
+			end = len(page)
+		}
+		// The first 4 bytes of the deleted cell were overwritten by the freeblock header
+		records = append(records, scanRecords(page, freeblock+4, end, table, true)...)
+		freeblock = int(binary.BigEndian.Uint16(page[freeblock:]))
+	}
+	return records
+}
+
+// parseCell reads a cell of a table leaf page, following its overflow pages
+func (f *sqliteFile) parseCell(page []byte, offset int, table carveTable) (CarvedRecord, bool) {
+	if offset <= 0 || offset >= len(page) {
+		return CarvedRecord{}, false
+	}
+	payloadSize, n := readVarint(page[offset:])
+	if n == 0 {
+		return CarvedRecord{}, false
+	}
+	rowid, m := readVarint(page[offset+n:])
+	if m == 0 || payloadSize > uint64(len(f.data)) {
+		return CarvedRecord{}, false
+	}
+	start := offset + n + m
+
+	// Payload spilling over the maximum local size continues in overflow pages
+	local := int(payloadSize)
+	maxLocal := f.usable - 35
+	if local > maxLocal {
+		minLocal := (f.usable-12)*32/255 - 23
+		local = minLocal + (int(payloadSize)-minLocal)%(f.usable-4)
+		if local > maxLocal {
+			local = minLocal
+		}
+	}
+	if start+local > len(page) {
+		return CarvedRecord{}, false
+	}
+	payload := append([]byte{}, page[start:start+local]...)
+	if local < int(payloadSize) && start+local+4 <= len(page) {
+		overflow := int(binary.BigEndian.Uint32(page[start+local:]))
+		visited := map[int]bool{}
+		for overflow > 0 && overflow <= f.pages && !visited[overflow] && len(payload) < int(payloadSize) {
+			visited[overflow] = true
+			data := f.page(overflow)
+			remaining := int(payloadSize) - len(payload)
+			if remaining > len(data)-4 {
+				remaining = len(data) - 4
+			}
+			payload = append(payload, data[4:4+remaining]...)
+			overflow = int(binary.BigEndian.Uint32(data[0:4]))
+		}
+	}
+
+	values, size, truncated, ok := parseRecord(payload, 0, len(payload), table, -1)
+	if !ok || size > len(payload) {
+		return CarvedRecord{}, false
+	}
+	record := newCarvedRecord(table, values, int64(rowid), "high")
+	if truncated || len(payload) < int(payloadSize) {
+		record.Confidence = "low"
+	}
+	return record, true
+}
+
+// scanRecords looks for records at every offset of a region of a page
+func scanRecords(page []byte, start int, end int, table carveTable, freeblock bool) []CarvedRecord {
+	var records []CarvedRecord
+	if start < 0 || start >= end {
+		return records
+	}
+
+	found := false
+	for offset := start; offset < end; offset++ {
+		values, size, truncated, ok := parseRecord(page, offset, end, table, -1)
+		if !ok {
+			continue
+		}
+		confidence := "medium"
+		if truncated {
+			confidence = "low"
+		}
+		records = append(records, newCarvedRecord(table, values, 0, confidence))
+		if offset < start+16 {
+			found = true
+		}
+		offset += size - 1
+	}
+
+	// The header size of a record at the start of a freeblock may have been overwritten, rebuild it from the column count
+	if freeblock && !found {
+	search:
+		for offset := start; offset < start+8 && offset < end; offset++ {
+			for columns := len(table.columns); columns >= len(table.columns)-1 && columns > 0; columns-- {
+				values, _, _, ok := parseRecord(page, offset, end, table, columns)
+				if ok {
+					records = append(records, newCarvedRecord(table, values, 0, "low"))
+					break search
+				}
+			}
+		}
+	}
+	return records
+}
+
+// parseRecord decodes a record at offset, columns is the number of serial types left when the header size is lost (-1 otherwise)
+// It returns the values, the record size, and whether the record was cut by the end of the region
+func parseRecord(data []byte, offset int, end int, table carveTable, columns int) ([]interface{}, int, bool, bool) {
+	position := offset
+	headerEnd := -1
+	if columns < 0 {
+		headerSize, n := readVarint(data[offset:end])
+		if n == 0 || headerSize < 2 || int(headerSize) > end-offset || headerSize > 9*uint64(len(table.columns))+9 {
+			return nil, 0, false, false
+		}
+		headerEnd = offset + int(headerSize)
+		position += n
+	}
+
+	// Serial types overwritten at the start of a headerless record can only be the NULL of an INTEGER PRIMARY KEY
+	var serialTypes []uint64
+	if columns >= 0 {
+		for len(serialTypes) < len(table.columns)-columns {
+			if !table.columns[len(serialTypes)].rowid {
+				return nil, 0, false, false
+			}
+			serialTypes = append(serialTypes, 0)
+		}
+	}
+	for (headerEnd < 0 && len(serialTypes) < len(table.columns)) || (headerEnd >= 0 && position < headerEnd) {
+		if len(serialTypes) >= len(table.columns) || position >= end {
+			return nil, 0, false, false
+		}
+		serialType, n := readVarint(data[position:end])
+		if n == 0 || !table.columns[len(serialTypes)].compatible(serialType) {
+			return nil, 0, false, false
+		}
+		serialTypes = append(serialTypes, serialType)
+		position += n
+	}
+	if (headerEnd >= 0 && position != headerEnd) || len(serialTypes) < table.minColumns {
+		return nil, 0, false, false
+	}
+
+	// Values may continue past the region, e.g. over a cell allocated later, only the page bounds the record
+	truncated := false
+	values := make([]interface{}, len(serialTypes))
+	for i, serialType := range serialTypes {
+		size := serialSize(serialType)
+		if position+size > end {
+			truncated = true
+			if position+size > len(data) {
+				if serialType < 12 {
+					return nil, 0, false, false
+				}
+				size = len(data) - position
+			}
+		}
+		value := data[position : position+size]
+		switch {
+		case serialType == 0:
+			values[i] = nil
+		case serialType == 7:
+			values[i] = math.Float64frombits(binary.BigEndian.Uint64(value))
+		case serialType == 8:
+			values[i] = int64(0)
+		case serialType == 9:
+			values[i] = int64(1)
+		case serialType < 7:
+			values[i] = readInteger(value)
+		case serialType%2 == 1:
+			if !utf8.Valid(value) && !truncated {
+				return nil, 0, false, false
+			}
+			values[i] = strings.ToValidUTF8(string(value), "")
+		default:
+			values[i] = append([]byte{}, value...)
+		}
+		position += size
+	}
+
+	return values, position - offset, truncated, true
+}
+
+func newCarvedRecord(table carveTable, values []interface{}, rowid int64, confidence string) CarvedRecord {
+	record := CarvedRecord{Table: table.name, Rowid: rowid, Values: map[string]interface{}{}, Confidence: confidence}
+	for i, column := range table.columns {
+		if i < len(values) {
+			record.Values[column.name] = values[i]
+		}
+		if column.rowid && rowid != 0 {
+			record.Values[column.name] = rowid
+		}
+	}
+	return record
+}
+
+// readVarint decodes a SQLite big-endian varint, n is 0 when data is too short
+func readVarint(data []byte) (uint64, int) {
+	var value uint64
+	for i := 0; i < 9; i++ {
+		if i >= len(data) {
+			return 0, 0
+		}
+		if i == 8 {
+			return value<<8 | uint64(data[i]), 9
+		}
+		value = value<<7 | uint64(data[i]&0x7f)
+		if data[i]&0x80 == 0 {
+			return value, i + 1
+		}
+	}
+	return value, 9
+}
+
+func serialSize(serialType uint64) int {
+	switch {
+	case serialType >= 12:
+		return int((serialType - 12) / 2)
+	case serialType == 5:
+		return 6
+	case serialType == 6, serialType == 7:
+		return 8
+	case serialType >= 1 && serialType <= 4:
+		return int(serialType)
+	}
+	return 0
+}
+
+// readInteger decodes a big-endian two's complement integer of 1 to 8 bytes
+func readInteger(data []byte) int64 {
+	var value int64
+	if data[0]&0x80 != 0 {
+		value = -1
+	}
+	for _, b := range data {
+		value = value<<8 | int64(b)
+	}
+	return value
+}
+
+// Int returns an integer value of a carved record, 0 when missing
+func (r CarvedRecord) Int(column string) int {
+	switch value := r.Values[column].(type) {
+	case int64:
+		return int(value)
+	case float64:
+		return int(value)
+	}
+	return 0
+}
+
+// String returns a text value of a carved record, "" when missing
+func (r CarvedRecord) String(column string) string {
+	if value, ok := r.Values[column].(string); ok {
+		return value
+	}
+	return ""
+}
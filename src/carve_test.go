@@ -0,0 +1,86 @@
+package src
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeDeletedDatabase writes a database of visits where one visit was deleted from a live page,
+// and the last visits were deleted, putting their pages on the freelist
+func writeDeletedDatabase(t *testing.T) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "history.sqlite")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	statements := []string{
+		"PRAGMA page_size=1024;",
+		"PRAGMA secure_delete=OFF;",
+		"PRAGMA auto_vacuum=NONE;",
+		"CREATE TABLE visits (id INTEGER PRIMARY KEY, url TEXT NOT NULL, title TEXT, visit_date INTEGER);",
+	}
+	for i := 1; i <= 40; i++ {
+		statements = append(statements, fmt.Sprintf("INSERT INTO visits (url, title, visit_date) VALUES ('https://site%d.example/%s', 'Site %d', %d);",
+			i, strings.Repeat("p", 60), i, 1700000000000000+i))
+	}
+	statements = append(statements,
+		"DELETE FROM visits WHERE id = 3;",
+		"DELETE FROM visits WHERE id > 20;",
+	)
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatal(statement, err)
+		}
+	}
+	return path
+}
+
+func TestCarveRecords(t *testing.T) {
+	path := writeDeletedDatabase(t)
+
+	db, err := OpenDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var freelist int
+	if err := db.QueryRow("PRAGMA freelist_count;").Scan(&freelist); err != nil || freelist == 0 {
+		t.Fatalf("no page on the freelist (%d, %v)", freelist, err)
+	}
+
+	carved := map[int][]CarvedRecord{}
+	for _, record := range CarveRecords(db, "visits", "url", "visit_date") {
+		var site int
+		if _, err := fmt.Sscanf(record.String("url"), "https://site%d.example/", &site); err != nil {
+			t.Errorf("carved a garbled url %q", record.String("url"))
+			continue
+		}
+		if record.String("title") != fmt.Sprint("Site ", site) || record.Int("visit_date") != 1700000000000000+site {
+			t.Errorf("visit %d carved as %v", site, record.Values)
+		}
+		carved[site] = append(carved[site], record)
+	}
+
+	// The visit deleted from a live page is in a freeblock, its cell header is overwritten
+	if len(carved[3]) == 0 || carved[3][0].Confidence == "high" {
+		t.Errorf("deleted visit 3 carved as %v, expected from a freeblock", carved[3])
+	}
+	// The last page of visits is on the freelist with its cells intact
+	for site := 37; site <= 40; site++ {
+		found := false
+		for _, record := range carved[site] {
+			found = found || (record.Confidence == "high" && record.Rowid == int64(site))
+		}
+		if !found {
+			t.Errorf("deleted visit %d not carved from the freelist: %v", site, carved[site])
+		}
+	}
+}
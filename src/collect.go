@@ -0,0 +1,236 @@
+package src
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+/**
+ * Evidence collection: the source files of the artifacts are copied into a zip, to be parsed later.
+ * Files keep their path relative to the root of the target system and their modification time, the SQLite
+ * -wal, -shm and -journal siblings are copied along. Each file is first copied to a temporary file, a file which cannot
+ * be read (locked, permission denied) is recorded as failed in the manifest instead of leaving a truncated entry.
+ * The manifest (manifest.csv at the root of the zip) lists the path, size, SHA-256 and acquisition time of every file.
+ */
+
+// Name of the manifest in the collection
+const CollectionManifest = "manifest.csv"
+
+var collectSiblings = []string{"-wal", "-shm", "-journal"}
+
+type CollectedFile struct {
+	Path        string // Path on the host filesystem
+	ArchivePath string // Path in the zip, relative to the root of the target system
+	Size        int64
+	SHA256      string
+	Modified    time.Time
+	Acquired    time.Time
+	Error       string // Why the file could not be copied
+}
+
+type Collection struct {
+	file      *os.File
+	zip       *zip.Writer
+	workspace string
+	seen      map[string]bool
+	Files     []CollectedFile
+	SHA256    string // Of the zip, set by Close
+}
+
+func NewCollection(path string) (*Collection, error) {
+	workspace, err := os.MkdirTemp("", "BrowserArtifact-collect-")
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		os.RemoveAll(workspace)
+		return nil, err
+	}
+	return &Collection{file: file, zip: zip.NewWriter(file), workspace: workspace, seen: map[string]bool{}}, nil
+}
+
+// Add copies a file with its SQLite siblings, or every file of a directory. Paths not found are ignored.
+func (c *Collection) Add(path string) error {
+	info, err := TargetStat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		Log.Log("debug", "src", "collect", "Not found: "+path)
+		return nil
+	}
+	if err != nil {
+		c.failed(path, err)
+		return nil
+	}
+
+	if !info.IsDir() {
+		for _, file := range append([]string{path}, siblings(path)...) {
+			if err := c.addFile(file); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return TargetWalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			c.failed(file, err)
+			return nil
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		return c.addFile(file)
+	})
+}
+
+// siblings returns the existing -wal, -shm and -journal files of a database
+func siblings(path string) []string {
+	var files []string
+	for _, suffix := range collectSiblings {
+		if CheckPath(path+suffix, false) {
+			files = append(files, path+suffix)
+		}
+	}
+	return files
+}
+
+// addFile copies a file into the zip, an error is returned only when the zip cannot be written
+func (c *Collection) addFile(path string) error {
+	if c.seen[path] {
+		return nil
+	}
+	c.seen[path] = true
+
+	info, err := TargetStat(path)
+	if err != nil {
+		c.failed(path, err)
+		return nil
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+
+	copyPath := filepath.Join(c.workspace, "file")
+	hash, err := copyFile(path, copyPath)
+	defer os.Remove(copyPath)
+	if err != nil {
+		c.failed(path, err)
+		return nil
+	}
+	acquired := time.Now()
+
+	copied, err := os.Open(copyPath)
+	if err != nil {
+		return err
+	}
+	defer copied.Close()
+	copiedInfo, err := copied.Stat()
+	if err != nil {
+		return err
+	}
+
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = ArchivePath(path)
+	header.Method = zip.Deflate
+	writer, err := c.zip.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(writer, copied); err != nil {
+		return err
+	}
+
+	c.Files = append(c.Files, CollectedFile{
+		Path:        path,
+		ArchivePath: header.Name,
+		Size:        copiedInfo.Size(),
+		SHA256:      hash,
+		Modified:    info.ModTime(),
+		Acquired:    acquired,
+	})
+	Log.Log("debug", "src", "collect", "Collected "+path+" SHA-256 "+hash)
+	return nil
+}
+
+func (c *Collection) failed(path string, err error) {
+	Log.Log("error", "src", "collect", "Failed to collect "+path+": "+err.Error())
+	c.Files = append(c.Files, CollectedFile{Path: path, ArchivePath: ArchivePath(path), Acquired: time.Now(), Error: err.Error()})
+}
+
+// Failed returns the number of files which could not be copied
+func (c *Collection) Failed() int {
+	failed := 0
+	for _, file := range c.Files {
+		if file.Error != "" {
+			failed++
+		}
+	}
+	return failed
+}
+
+// ArchivePath returns the path of a file in the collection: its path relative to the root of the target system
+func ArchivePath(path string) string {
+	relative, err := filepath.Rel(TargetPath(), path)
+	if err != nil || strings.HasPrefix(relative, "..") {
+		relative = strings.TrimPrefix(path, filepath.VolumeName(path))
+	}
+	return strings.TrimLeft(filepath.ToSlash(relative), "/")
+}
+
+// Close writes the manifest, closes the zip and hashes it
+func (c *Collection) Close() error {
+	defer os.RemoveAll(c.workspace)
+
+	err := c.writeManifest()
+	if closeErr := c.zip.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := c.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	c.SHA256, err = hashFile(c.file.Name())
+	return err
+}
+
+func (c *Collection) writeManifest() error {
+	header := &zip.FileHeader{Name: CollectionManifest, Method: zip.Deflate, Modified: time.Now()}
+	file, err := c.zip.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"path", "archive_path", "size", "sha256", "modified", "acquired", "status", "error"})
+	for _, collected := range c.Files {
+		status := "ok"
+		if collected.Error != "" {
+			status = "failed"
+		}
+		writer.Write([]string{
+			collected.Path,
+			collected.ArchivePath,
+			fmt.Sprint(collected.Size),
+			collected.SHA256,
+			FormatTime(collected.Modified),
+			FormatTime(collected.Acquired),
+			status,
+			collected.Error,
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,206 @@
+package src
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+/**
+ * Evidence-safe SQLite access: the browser databases are never opened in place.
+ * - copy: the database and its -wal/-journal siblings are copied to a temporary workspace and the copy is opened,
+ *   so uncommitted data sitting in the WAL is read without touching the original
+ * - immutable: the original is opened read-only with immutable=1, SQLite never writes nor locks it (the WAL is ignored)
+ * SHA-256 hashes of the original files are recorded when the database is opened and again when it is closed.
+ */
+
+var SQLiteAccess = "copy" // copy, immutable
+
+var sqliteSiblings = []string{"-wal", "-journal"}
+
+type EvidenceHash struct {
+	Path   string
+	Size   int64
+	Before string
+	After  string
+}
+
+var evidenceHashes []EvidenceHash
+var evidenceMutex sync.Mutex
+
+// EvidenceHashes returns the hashes recorded for every database file read so far
+func EvidenceHashes() []EvidenceHash {
+	evidenceMutex.Lock()
+	defer evidenceMutex.Unlock()
+	return append([]EvidenceHash{}, evidenceHashes...)
+}
+
+type Database struct {
+	*sql.DB
+	path      string
+	workspace string
+	before    map[string]string
+}
+
+func OpenDatabase(path string) (*Database, error) {
+	database := &Database{path: path, before: map[string]string{}}
+
+	var err error
+	dsn := ""
+	// SQLite opens files of the host only, databases of a zip are always copied
+	access := SQLiteAccess
+	if TargetFS != nil {
+		access = "copy"
+	}
+	switch access {
+	case "copy":
+		database.workspace, err = os.MkdirTemp("", "BrowserArtifact-")
+		if err != nil {
+			return nil, err
+		}
+		copyPath := filepath.Join(database.workspace, "database")
+		for _, file := range databaseFiles(path) {
+			hash, err := copyFile(file, copyPath+file[len(path):])
+			if err != nil {
+				os.RemoveAll(database.workspace)
+				return nil, err
+			}
+			database.before[file] = hash
+		}
+		dsn = sqliteURI(copyPath, "")
+	case "immutable":
+		for _, file := range databaseFiles(path) {
+			hash, err := hashFile(file)
+			if err != nil {
+				return nil, err
+			}
+			database.before[file] = hash
+		}
+		dsn = sqliteURI(path, "mode=ro&immutable=1")
+	default:
+		return nil, errors.New("unknown SQLite access mode: " + SQLiteAccess)
+	}
+
+	database.DB, err = openSQLite(dsn)
+	if err != nil {
+		database.Close()
+		return nil, err
+	}
+
+	return database, nil
+}
+
+func openSQLite(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Ping()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Close closes the database, removes its workspace and hashes the original files again
+func (d *Database) Close() error {
+	var err error
+	if d.DB != nil {
+		err = d.DB.Close()
+	}
+	if d.workspace != "" {
+		os.RemoveAll(d.workspace)
+	}
+
+	evidenceMutex.Lock()
+	defer evidenceMutex.Unlock()
+	for _, file := range databaseFiles(d.path) {
+		before, ok := d.before[file]
+		if !ok {
+			Log.Log("warn", "src", "database", "File appeared while reading the database: "+file)
+			continue
+		}
+		after, _ := hashFile(file)
+		if after != before {
+			Log.Log("warn", "src", "database", "File changed while reading the database (live browser?): "+file)
+		}
+		var size int64
+		if info, statErr := TargetStat(file); statErr == nil {
+			size = info.Size()
+		}
+		evidenceHashes = append(evidenceHashes, EvidenceHash{Path: file, Size: size, Before: before, After: after})
+		Log.Log("debug", "src", "database", "SHA-256 "+file+" before="+before+" after="+after)
+	}
+
+	return err
+}
+
+// databaseFiles returns the database file and its existing -wal/-journal siblings
+func databaseFiles(path string) []string {
+	files := []string{path}
+	for _, suffix := range sqliteSiblings {
+		if CheckPath(path+suffix, false) {
+			files = append(files, path+suffix)
+		}
+	}
+	return files
+}
+
+func hashFile(path string) (string, error) {
+	file, err := TargetOpen(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// copyFile copies a file and returns the SHA-256 of the data read from the source
+func copyFile(source string, destination string) (string, error) {
+	input, err := TargetOpen(source)
+	if err != nil {
+		return "", err
+	}
+	defer input.Close()
+
+	output, err := os.Create(destination)
+	if err != nil {
+		return "", err
+	}
+	defer output.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(output, io.TeeReader(input, hash))
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// sqliteURI builds a file: URI, escaping characters such as spaces or '?' found in browser paths
+func sqliteURI(path string, query string) string {
+	path = filepath.ToSlash(path)
+	if filepath.VolumeName(path) != "" {
+		path = "/" + path
+	}
+	uri := "file:" + (&url.URL{Path: path}).EscapedPath()
+	if query != "" {
+		uri += "?" + query
+	}
+	return uri
+}
@@ -7,116 +7,163 @@ import (
 	"os"
 )
 
-func ExportCSV(path string, artifacts []BrowserArtifact) {
-	// Open file
+func init() {
+	RegisterFormat(Format{Name: "csv", Extension: ".csv", Description: "CSV with a header line", New: func() Exporter { return &CSVExporter{} }})
+}
+
+var csvHeader = []string{
+	"ArtifactType",
+	"Dest",
+	"Src",
+	"User",
+	"App",
+	"Action",
+	"Cached",
+	"Cookie",
+	"Url",
+	"UrlDomain",
+	"HttpMethod",
+	"HttpReferrer",
+	"HttpUserAgent",
+	"HttpContentType",
+	"HttpServer",
+	"Duration",
+	"Status",
+	"BytesIn",
+	"BytesOut",
+	"Time",
+	"Timestamp",
+	"TimestampType",
+	"TimestampRaw",
+	"TimestampEpoch",
+	"TimestampWarning",
+	"BrowserProfile",
+	"BrowserProfileName",
+	"BrowserAccount",
+	"BrowserProfileDefault",
+	"BrowserInstall",
+	"Recovery",
+	"Confidence",
+	"Typed",
+	"VisitCount",
+	"Title",
+	"BookmarkTitle",
+	"BookmarkFolder",
+	"BackupDate",
+	"SessionWindow",
+	"SessionTab",
+	"NavigationIndex",
+	"Transition",
+	"Metadata",
+	"Filename",
+	"Fieldname",
+	"Value",
+	"AddonName",
+	"AddonType",
+	"Active",
+	"Visible",
+	"Description",
+	"FullDescription",
+	"Version",
+	"SourceURI",
+	"HomePageURL",
+	"AboutURL",
+	"ReviewURL",
+	"CreatorName",
+	"CreatorURL",
+	"AverageRating",
+	"RatingCount",
+}
+
+// CSVExporter writes artifacts to a CSV file as they come
+type CSVExporter struct {
+	file   *os.File
+	writer *csv.Writer
+}
+
+func (w *CSVExporter) Begin(path string) error {
 	file, err := os.Create(path)
 	if err != nil {
-		return
+		return err
 	}
-	defer file.Close()
 
-	// Write CSV data to file
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+	w.file = file
+	w.writer = csv.NewWriter(file)
+	return w.writer.Write(csvHeader)
+}
 
-	// Write header
-	header := []string{
-		"ArtifactType",
-		"Dest",
-		"Src",
-		"User",
-		"App",
-		"Action",
-		"Cached",
-		"Cookie",
-		"Url",
-		"UrlDomain",
-		"HttpMethod",
-		"HttpReferrer",
-		"HttpUserAgent",
-		"HttpContentType",
-		"Duration",
-		"Status",
-		"BytesIn",
-		"BytesOut",
-		"Timestamp",
-		"TimestampType",
-		"Typed",
-		"VisitCount",
-		"Title",
-		"BookmarkTitle",
-		"Metadata",
-		"Filename",
-		"Fieldname",
-		"Value",
-		"AddonName",
-		"AddonType",
-		"Active",
-		"Visible",
-		"Description",
-		"FullDescription",
-		"Version",
-		"SourceURI",
-		"HomePageURL",
-		"AboutURL",
-		"ReviewURL",
-		"CreatorName",
-		"CreatorURL",
-		"AverageRating",
-		"RatingCount",
+func (w *CSVExporter) Write(artifact BrowserArtifact) error {
+	record := []string{
+		artifact.ArtifactType,
+		artifact.Dest,
+		artifact.Src,
+		artifact.User,
+		artifact.App,
+		artifact.Action,
+		fmt.Sprintf("%t", artifact.Cached),
+		artifact.Cookie,
+		artifact.Url,
+		artifact.UrlDomain,
+		artifact.HttpMethod,
+		artifact.HttpReferrer,
+		artifact.HttpUserAgent,
+		artifact.HttpContentType,
+		artifact.HttpServer,
+		fmt.Sprintf("%d", artifact.Duration),
+		artifact.Status,
+		fmt.Sprintf("%d", artifact.BytesIn),
+		fmt.Sprintf("%d", artifact.BytesOut),
+		FormatTime(artifact.Time),
+		fmt.Sprintf("%d", artifact.Timestamp),
+		artifact.TimestampType,
+		fmt.Sprintf("%d", artifact.TimestampRaw),
+		artifact.TimestampEpoch,
+		artifact.TimestampWarning,
+		artifact.BrowserProfile,
+		artifact.BrowserProfileName,
+		artifact.BrowserAccount,
+		fmt.Sprintf("%t", artifact.BrowserProfileDefault),
+		artifact.BrowserInstall,
+		artifact.Recovery,
+		artifact.Confidence,
+		fmt.Sprintf("%d", artifact.Typed),
+		fmt.Sprintf("%d", artifact.VisitCount),
+		artifact.Title,
+		artifact.BookmarkTitle,
+		artifact.BookmarkFolder,
+		artifact.BackupDate,
+		fmt.Sprintf("%d", artifact.SessionWindow),
+		fmt.Sprintf("%d", artifact.SessionTab),
+		fmt.Sprintf("%d", artifact.NavigationIndex),
+		artifact.Transition,
+		artifact.Metadata,
+		artifact.Filename,
+		artifact.Fieldname,
+		artifact.Value,
+		artifact.AddonName,
+		artifact.AddonType,
+		fmt.Sprintf("%t", artifact.Active),
+		fmt.Sprintf("%t", artifact.Visible),
+		artifact.Description,
+		artifact.FullDescription,
+		artifact.Version,
+		artifact.SourceURI,
+		artifact.HomePageURL,
+		artifact.AboutURL,
+		artifact.ReviewURL,
+		artifact.CreatorName,
+		artifact.CreatorURL,
+		fmt.Sprintf("%f", artifact.AverageRating),
+		fmt.Sprintf("%d", artifact.RatingCount),
 	}
-	err = writer.Write(header)
+	return w.writer.Write(record)
+}
 
-	for _, artifact := range artifacts {
-		record := []string{
-			artifact.ArtifactType,
-			artifact.Dest,
-			artifact.Src,
-			artifact.User,
-			artifact.App,
-			artifact.Action,
-			fmt.Sprintf("%t", artifact.Cached),
-			artifact.Cookie,
-			artifact.Url,
-			artifact.UrlDomain,
-			artifact.HttpMethod,
-			artifact.HttpReferrer,
-			artifact.HttpUserAgent,
-			artifact.HttpContentType,
-			fmt.Sprintf("%d", artifact.Duration),
-			artifact.Status,
-			fmt.Sprintf("%d", artifact.BytesIn),
-			fmt.Sprintf("%d", artifact.BytesOut),
-			fmt.Sprintf("%d", artifact.Timestamp),
-			artifact.TimestampType,
-			fmt.Sprintf("%d", artifact.Typed),
-			fmt.Sprintf("%d", artifact.VisitCount),
-			artifact.Title,
-			artifact.BookmarkTitle,
-			artifact.Metadata,
-			artifact.Filename,
-			artifact.Fieldname,
-			artifact.Value,
-			artifact.AddonName,
-			artifact.AddonType,
-			fmt.Sprintf("%t", artifact.Active),
-			fmt.Sprintf("%t", artifact.Visible),
-			artifact.Description,
-			artifact.FullDescription,
-			artifact.Version,
-			artifact.SourceURI,
-			artifact.HomePageURL,
-			artifact.AboutURL,
-			artifact.ReviewURL,
-			artifact.CreatorName,
-			artifact.CreatorURL,
-			fmt.Sprintf("%f", artifact.AverageRating),
-			fmt.Sprintf("%d", artifact.RatingCount),
-		}
-		err := writer.Write(record)
-		if err != nil {
-			fmt.Println(err)
-			return
-		}
+func (w *CSVExporter) End() error {
+	w.writer.Flush()
+	if err := w.writer.Error(); err != nil {
+		w.file.Close()
+		return err
 	}
+	return w.file.Close()
 }
@@ -0,0 +1,58 @@
+package export
+
+import (
+	. "local/BrowserArtifact/src"
+	"sort"
+)
+
+/**
+ * Registry of the output formats.
+ * Exporters register themselves from init() with the name used by -format and the extension of their files.
+ */
+
+type Exporter interface {
+	Begin(path string) error              // Create the output file
+	Write(artifact BrowserArtifact) error // Write one artifact
+	End() error                           // Finish and close the output file
+}
+
+type Format struct {
+	Name        string
+	Extension   string
+	Description string
+	Sink        bool // Sent to a remote endpoint, the path given to Begin is a local spool
+	New         func() Exporter
+}
+
+var formats []Format
+
+func log(level string, source string, message string) {
+	Log.Log(level, "export", source, message)
+}
+
+func RegisterFormat(format Format) {
+	for _, registered := range formats {
+		if registered.Name == format.Name {
+			panic("format registered twice: " + format.Name)
+		}
+	}
+	formats = append(formats, format)
+}
+
+// Formats returns the registered formats sorted by name
+func Formats() []Format {
+	sorted := append([]Format{}, formats...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
+
+func GetFormat(name string) (Format, bool) {
+	for _, format := range formats {
+		if format.Name == name {
+			return format, true
+		}
+	}
+	return Format{}, false
+}
@@ -0,0 +1,13 @@
+package export
+
+import (
+	"io"
+	. "local/BrowserArtifact/src"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	Log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
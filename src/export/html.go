@@ -0,0 +1,309 @@
+package export
+
+import (
+	"bufio"
+	"embed"
+	"encoding/json"
+	"html/template"
+	"io"
+	. "local/BrowserArtifact/src"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+/**
+ * Single file HTML report for readers who will not open a CSV.
+ * Summaries are computed while the artifacts are written, the artifacts themselves are spooled to a temporary file
+ * and embedded as JSON at the end of the page, where the timeline script reads them. Nothing is loaded from the network.
+ */
+
+//go:embed report
+var reportFiles embed.FS
+
+var reportTemplate = template.Must(template.ParseFS(reportFiles, "report/report.html"))
+
+// Number of domains listed in the report
+const reportDomains = 25
+
+func init() {
+	RegisterFormat(Format{Name: "html", Extension: ".html", Description: "Self-contained HTML report", New: func() Exporter { return &HTMLExporter{} }})
+}
+
+type reportCount struct {
+	Name  string
+	Count int
+}
+
+type reportProfile struct {
+	User        string
+	App         string
+	Profile     string
+	ProfileName string
+	Count       int
+	first       time.Time
+	last        time.Time
+	First       string
+	Last        string
+}
+
+type reportDownload struct {
+	Time     string
+	User     string
+	App      string
+	Filename string
+	Url      string
+	MimeType string
+	Bytes    int
+	time     time.Time
+}
+
+type reportExtension struct {
+	Name    string
+	Version string
+	Type    string
+	User    string
+	App     string
+	Profile string
+	Source  string
+}
+
+type reportMetadata struct {
+	Key   string
+	Value string
+}
+
+type reportData struct {
+	Style      template.CSS
+	Script     template.JS
+	Metadata   []reportMetadata
+	Total      int
+	Recovered  int
+	Profiles   []*reportProfile
+	Types      []reportCount
+	Domains    []reportCount
+	Downloads  []reportDownload
+	Extensions []reportExtension
+}
+
+// HTMLExporter writes the report
+type HTMLExporter struct {
+	file       *os.File
+	spool      *os.File
+	writer     *bufio.Writer
+	total      int
+	recovered  int
+	profiles   map[string]*reportProfile
+	types      map[string]int
+	domains    map[string]int
+	downloads  []reportDownload
+	extensions map[string]reportExtension
+}
+
+func (w *HTMLExporter) Begin(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	spool, err := os.CreateTemp("", "BrowserArtifact-report-")
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	w.file = file
+	w.spool = spool
+	w.writer = bufio.NewWriter(spool)
+	w.profiles = map[string]*reportProfile{}
+	w.types = map[string]int{}
+	w.domains = map[string]int{}
+	w.extensions = map[string]reportExtension{}
+	return nil
+}
+
+func (w *HTMLExporter) Write(artifact BrowserArtifact) error {
+	// json.Marshal escapes <, > and &, the data cannot close its script element
+	jsonData, err := json.Marshal(artifact)
+	if err != nil {
+		return err
+	}
+	if w.total > 0 {
+		jsonData = append([]byte(",\n"), jsonData...)
+	}
+	if _, err := w.writer.Write(jsonData); err != nil {
+		return err
+	}
+
+	w.total++
+	if artifact.Recovery != "" {
+		w.recovered++
+	}
+	w.types[artifact.ArtifactType]++
+	if artifact.UrlDomain != "" {
+		w.domains[artifact.UrlDomain]++
+	}
+
+	key := artifact.User + "\x00" + artifact.App + "\x00" + artifact.BrowserProfile
+	profile, ok := w.profiles[key]
+	if !ok {
+		profile = &reportProfile{User: artifact.User, App: artifact.App, Profile: artifact.BrowserProfile, ProfileName: artifact.BrowserProfileName}
+		w.profiles[key] = profile
+	}
+	profile.Count++
+	if !artifact.Time.IsZero() && artifact.TimestampEpoch != EpochCollection {
+		if profile.first.IsZero() || artifact.Time.Before(profile.first) {
+			profile.first = artifact.Time
+		}
+		if artifact.Time.After(profile.last) {
+			profile.last = artifact.Time
+		}
+	}
+
+	switch artifact.ArtifactType {
+	case "download":
+		w.downloads = append(w.downloads, reportDownload{
+			Time:     FormatTime(artifact.Time),
+			User:     artifact.User,
+			App:      artifact.App,
+			Filename: artifact.Filename,
+			Url:      artifact.Url,
+			MimeType: artifact.MimeType,
+			Bytes:    artifact.BytesIn + artifact.BytesOut,
+			time:     artifact.Time,
+		})
+	case "extension", "addon":
+		// An extension is written once per time it holds, it is listed once
+		extension := reportExtension{
+			Name:    artifact.AddonName,
+			Version: artifact.Version,
+			Type:    artifact.AddonType,
+			User:    artifact.User,
+			App:     artifact.App,
+			Profile: artifact.BrowserProfile,
+			Source:  artifact.SourceURI,
+		}
+		w.extensions[strings.Join([]string{extension.User, extension.App, extension.Profile, extension.Name, extension.Version}, "\x00")] = extension
+	}
+	return nil
+}
+
+func (w *HTMLExporter) End() error {
+	defer os.Remove(w.spool.Name())
+	defer w.spool.Close()
+
+	err := w.writeReport()
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (w *HTMLExporter) writeReport() error {
+	if err := w.writer.Flush(); err != nil {
+		return err
+	}
+	if _, err := w.spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	style, err := reportFiles.ReadFile("report/report.css")
+	if err != nil {
+		return err
+	}
+	script, err := reportFiles.ReadFile("report/report.js")
+	if err != nil {
+		return err
+	}
+	data := w.reportData()
+	data.Style = template.CSS(style)
+	data.Script = template.JS(script)
+
+	writer := bufio.NewWriter(w.file)
+	if err := reportTemplate.ExecuteTemplate(writer, "header", data); err != nil {
+		return err
+	}
+	if _, err := writer.WriteString("<script id=\"artifacts\" type=\"application/json\">[\n"); err != nil {
+		return err
+	}
+	if _, err := io.Copy(writer, w.spool); err != nil {
+		return err
+	}
+	if _, err := writer.WriteString("\n]</script>\n"); err != nil {
+		return err
+	}
+	if err := reportTemplate.ExecuteTemplate(writer, "footer", data); err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
+// reportData sorts the summaries computed while writing
+func (w *HTMLExporter) reportData() reportData {
+	data := reportData{Total: w.total, Recovered: w.recovered}
+
+	var keys []string
+	for key := range RunMetadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		data.Metadata = append(data.Metadata, reportMetadata{key, RunMetadata[key]})
+	}
+
+	for _, profile := range w.profiles {
+		profile.First = FormatTime(profile.first)
+		profile.Last = FormatTime(profile.last)
+		data.Profiles = append(data.Profiles, profile)
+	}
+	sort.Slice(data.Profiles, func(i, j int) bool {
+		a, b := data.Profiles[i], data.Profiles[j]
+		if a.User != b.User {
+			return a.User < b.User
+		}
+		if a.App != b.App {
+			return a.App < b.App
+		}
+		return a.Profile < b.Profile
+	})
+
+	data.Types = sortedCounts(w.types)
+	sort.Slice(data.Types, func(i, j int) bool {
+		return data.Types[i].Name < data.Types[j].Name
+	})
+
+	data.Domains = sortedCounts(w.domains)
+	if len(data.Domains) > reportDomains {
+		data.Domains = data.Domains[:reportDomains]
+	}
+
+	data.Downloads = w.downloads
+	sort.SliceStable(data.Downloads, func(i, j int) bool {
+		return data.Downloads[i].time.Before(data.Downloads[j].time)
+	})
+
+	for _, extension := range w.extensions {
+		data.Extensions = append(data.Extensions, extension)
+	}
+	sort.Slice(data.Extensions, func(i, j int) bool {
+		a, b := data.Extensions[i], data.Extensions[j]
+		return strings.Join([]string{a.User, a.App, a.Profile, a.Name, a.Version}, "\x00") <
+			strings.Join([]string{b.User, b.App, b.Profile, b.Name, b.Version}, "\x00")
+	})
+	return data
+}
+
+// sortedCounts returns the counts from the highest
+func sortedCounts(counts map[string]int) []reportCount {
+	var sorted []reportCount
+	for name, count := range counts {
+		sorted = append(sorted, reportCount{name, count})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Count != sorted[j].Count {
+			return sorted[i].Count > sorted[j].Count
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
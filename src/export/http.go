@@ -0,0 +1,193 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	. "local/BrowserArtifact/src"
+	"net/http"
+	"strings"
+	"time"
+)
+
+/**
+ * Sinks posting the artifacts to a Splunk HTTP Event Collector or an Elasticsearch _bulk endpoint.
+ */
+
+func init() {
+	RegisterFormat(Format{Name: "splunk_hec", Extension: ".splunk.spool", Description: "Splunk HTTP Event Collector (-splunk_url)", Sink: true, New: func() Exporter { return newSplunkSink() }})
+	RegisterFormat(Format{Name: "elasticsearch", Extension: ".elastic.spool", Description: "Elasticsearch _bulk endpoint, ECS documents (-elastic_url)", Sink: true, New: func() Exporter { return newElasticSink() }})
+}
+
+// Options of the sinks, set from the command line
+var (
+	SplunkSink  = SinkOptions{BatchSize: 500, Retries: 5, Backoff: time.Second, Timeout: 30 * time.Second}
+	ElasticSink = SinkOptions{Index: "browser-artifacts", BatchSize: 500, Retries: 5, Backoff: time.Second, Timeout: 30 * time.Second}
+	SplunkType  = "browser:artifact"
+)
+
+type httpSink struct {
+	*sink
+	client *http.Client
+}
+
+func newHTTPSink(name string, options *SinkOptions, eventLines int) *httpSink {
+	s := &httpSink{sink: &sink{name: name, options: options, eventLines: eventLines}}
+	s.connect = func() error {
+		config, err := TLSConfig(SinkTLS)
+		if err != nil {
+			return err
+		}
+		s.client = &http.Client{
+			Timeout:   s.options.Timeout,
+			Transport: &http.Transport{TLSClientConfig: config, Proxy: http.ProxyFromEnvironment},
+		}
+		return nil
+	}
+	s.disconnect = func() {
+		if s.client != nil {
+			s.client.CloseIdleConnections()
+		}
+	}
+	return s
+}
+
+// post sends a request body, returning the response body of a successful request
+func (s *httpSink) post(url string, contentType string, authorization string, body []byte) ([]byte, error) {
+	request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, permanentError{err}
+	}
+	request.Header.Set("Content-Type", contentType)
+	if authorization != "" {
+		request.Header.Set("Authorization", authorization)
+	}
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	responseBody, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return responseBody, nil
+	}
+	err = fmt.Errorf("%s: %s", response.Status, strings.TrimSpace(string(responseBody)))
+	if response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500 {
+		return nil, err
+	}
+	return nil, permanentError{err}
+}
+
+// endpoint adds path to the URL when the URL has no path
+func endpoint(url string, path string) string {
+	url = strings.TrimSuffix(url, "/")
+	if strings.Count(url, "/") > 2 {
+		return url
+	}
+	return url + path
+}
+
+// newSplunkSink posts the artifacts, as written by json_line, to /services/collector/event
+func newSplunkSink() *httpSink {
+	s := newHTTPSink("splunk_hec", &SplunkSink, 1)
+	s.encode = func(artifact BrowserArtifact) ([]byte, error) {
+		jsonData, err := json.Marshal(artifact)
+		if err != nil {
+			return nil, err
+		}
+		e := event{}
+		e.set("event", json.RawMessage(jsonData))
+		if !artifact.Time.IsZero() {
+			e.set("time", json.Number(fmt.Sprintf("%d.%06d", artifact.Time.Unix(), artifact.Time.Nanosecond()/1000)))
+		}
+		e.set("host", RunMetadata["hostname"])
+		e.set("source", "BrowserArtifact")
+		e.set("sourcetype", SplunkType)
+		e.set("index", s.options.Index)
+		jsonData, err = json.Marshal(e)
+		return append(jsonData, '\n'), err
+	}
+	s.deliver = func(events [][]byte) ([][]byte, error) {
+		authorization := ""
+		if s.options.Token != "" {
+			authorization = "Splunk " + s.options.Token
+		}
+		responseBody, err := s.post(endpoint(s.options.URL, "/services/collector/event"), "application/json",
+			authorization, bytes.Join(events, nil))
+		if err != nil {
+			return nil, err
+		}
+		var response struct {
+			Code int    `json:"code"`
+			Text string `json:"text"`
+		}
+		if json.Unmarshal(responseBody, &response) == nil && response.Code != 0 {
+			return nil, permanentError{fmt.Errorf("%s (code %d)", response.Text, response.Code)}
+		}
+		return nil, nil
+	}
+	return s
+}
+
+// newElasticSink posts the artifacts as ECS documents to the _bulk endpoint
+func newElasticSink() *httpSink {
+	s := newHTTPSink("elasticsearch", &ElasticSink, 2)
+	s.encode = func(artifact BrowserArtifact) ([]byte, error) {
+		action, err := json.Marshal(map[string]map[string]string{"create": {"_index": s.options.Index}})
+		if err != nil {
+			return nil, err
+		}
+		document, err := json.Marshal(ecsEvent(artifact))
+		if err != nil {
+			return nil, err
+		}
+		return []byte(string(action) + "\n" + string(document) + "\n"), nil
+	}
+	s.deliver = func(events [][]byte) ([][]byte, error) {
+		authorization := ""
+		if s.options.Token != "" {
+			authorization = "ApiKey " + s.options.Token
+		}
+		responseBody, err := s.post(endpoint(s.options.URL, "/_bulk"), "application/x-ndjson", authorization, bytes.Join(events, nil))
+		if err != nil {
+			return nil, err
+		}
+
+		// The request succeeds even when documents are refused, items are in the order of the events
+		var response struct {
+			Errors bool `json:"errors"`
+			Items  []map[string]struct {
+				Status int             `json:"status"`
+				Error  json.RawMessage `json:"error"`
+			} `json:"items"`
+		}
+		if err := json.Unmarshal(responseBody, &response); err != nil {
+			return nil, permanentError{fmt.Errorf("invalid _bulk response: %s", err.Error())}
+		}
+		if !response.Errors {
+			return nil, nil
+		}
+
+		var retry [][]byte
+		for i, item := range response.Items {
+			for _, result := range item {
+				switch {
+				case result.Status < 300 || i >= len(events):
+				case result.Status == http.StatusTooManyRequests || result.Status >= 500:
+					retry = append(retry, events[i])
+				default:
+					s.rejected++
+					log("error", s.name, fmt.Sprintf("Document rejected (%d): %s", result.Status, string(result.Error)))
+				}
+			}
+		}
+		return retry, nil
+	}
+	return s
+}
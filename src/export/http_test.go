@@ -0,0 +1,226 @@
+package export
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testServer answers the requests with the responses in order, the last one is repeated
+type testServer struct {
+	*httptest.Server
+	mutex     sync.Mutex
+	requests  []*http.Request
+	bodies    []string
+	responses []testResponse
+}
+
+type testResponse struct {
+	status int
+	body   string
+}
+
+func newTestServer(t *testing.T, responses ...testResponse) *testServer {
+	server := &testServer{responses: responses}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		server.mutex.Lock()
+		server.requests = append(server.requests, r)
+		server.bodies = append(server.bodies, string(body))
+		response := server.responses[0]
+		if len(server.responses) > 1 {
+			server.responses = server.responses[1:]
+		}
+		server.mutex.Unlock()
+		w.WriteHeader(response.status)
+		io.WriteString(w, response.body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func testSinkOptions(url string) *SinkOptions {
+	return &SinkOptions{URL: url, Token: "secret", Index: "test", BatchSize: 10, Retries: 1, Backoff: time.Millisecond, Timeout: 5 * time.Second}
+}
+
+// writeSink writes the test artifacts to a sink spooling to path, returning the error of End
+func writeSink(t *testing.T, s *httpSink, path string) error {
+	t.Helper()
+	if err := s.Begin(path); err != nil {
+		t.Fatal(err)
+	}
+	for _, artifact := range testArtifacts() {
+		if err := s.Write(artifact); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s.End()
+}
+
+func spoolLines(t *testing.T, path string) int {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Count(string(data), "\n")
+}
+
+func TestSplunkSink(t *testing.T) {
+	server := newTestServer(t, testResponse{http.StatusOK, `{"text":"Success","code":0}`})
+	s := newSplunkSink()
+	s.options = testSinkOptions(server.URL)
+
+	if err := writeSink(t, s, filepath.Join(t.TempDir(), "spool")); err != nil {
+		t.Fatal(err)
+	}
+	if len(server.requests) != 1 {
+		t.Fatalf("got %d requests, expected 1", len(server.requests))
+	}
+	request := server.requests[0]
+	if request.URL.Path != "/services/collector/event" || request.Header.Get("Authorization") != "Splunk secret" {
+		t.Errorf("request to %s with authorization %q", request.URL.Path, request.Header.Get("Authorization"))
+	}
+	if lines := strings.Count(server.bodies[0], "\n"); lines != 3 {
+		t.Errorf("got %d events, expected 3", lines)
+	}
+	if !strings.Contains(server.bodies[0], `"sourcetype":"browser:artifact"`) || !strings.Contains(server.bodies[0], `"index":"test"`) {
+		t.Errorf("event without sourcetype or index: %s", server.bodies[0])
+	}
+	if s.sent != 3 || s.spooled != 0 {
+		t.Errorf("sent %d spooled %d, expected 3 and 0", s.sent, s.spooled)
+	}
+}
+
+func TestSplunkSinkErrorCode(t *testing.T) {
+	// HEC answers some errors with a success status and a code in the body, they are not retried
+	server := newTestServer(t, testResponse{http.StatusOK, `{"text":"Invalid token","code":4}`})
+	s := newSplunkSink()
+	s.options = testSinkOptions(server.URL)
+	spool := filepath.Join(t.TempDir(), "spool")
+
+	if err := writeSink(t, s, spool); err == nil {
+		t.Error("expected an error")
+	}
+	if len(server.requests) != 1 {
+		t.Errorf("got %d requests, expected 1", len(server.requests))
+	}
+	if s.sent != 0 || s.spooled != 3 || spoolLines(t, spool) != 3 {
+		t.Errorf("sent %d spooled %d, expected 0 and 3", s.sent, s.spooled)
+	}
+}
+
+func TestElasticSinkPartialFailure(t *testing.T) {
+	// The second document is retried after a 429, the third one is refused for good
+	server := newTestServer(t,
+		testResponse{http.StatusOK, `{"errors":true,"items":[{"create":{"status":201}},{"create":{"status":429,"error":{"type":"es_rejected_execution_exception"}}},{"create":{"status":400,"error":{"type":"mapper_parsing_exception"}}}]}`},
+		testResponse{http.StatusOK, `{"errors":false,"items":[{"create":{"status":201}}]}`},
+	)
+	s := newElasticSink()
+	s.options = testSinkOptions(server.URL)
+
+	err := writeSink(t, s, filepath.Join(t.TempDir(), "spool"))
+	if err == nil || !strings.Contains(err.Error(), "1 events rejected") {
+		t.Errorf("got error %v, expected 1 rejected event", err)
+	}
+	if len(server.requests) != 2 {
+		t.Fatalf("got %d requests, expected 2", len(server.requests))
+	}
+	if server.requests[0].URL.Path != "/_bulk" || server.requests[0].Header.Get("Authorization") != "ApiKey secret" {
+		t.Errorf("request to %s with authorization %q", server.requests[0].URL.Path, server.requests[0].Header.Get("Authorization"))
+	}
+	if lines := strings.Count(server.bodies[1], "\n"); lines != 2 || !strings.Contains(server.bodies[1], "tool.zip") {
+		t.Errorf("retried %q, expected the download only", server.bodies[1])
+	}
+	if s.sent != 2 || s.rejected != 1 || s.spooled != 0 {
+		t.Errorf("sent %d rejected %d spooled %d, expected 2, 1 and 0", s.sent, s.rejected, s.spooled)
+	}
+}
+
+func TestSinkSpoolAndResend(t *testing.T) {
+	spool := filepath.Join(t.TempDir(), "spool")
+
+	// The endpoint fails after the retries, the batch is spooled and the next ones go straight to the spool
+	down := newTestServer(t, testResponse{http.StatusServiceUnavailable, "unavailable"})
+	s := newElasticSink()
+	s.options = testSinkOptions(down.URL)
+	s.options.BatchSize = 2
+	if err := writeSink(t, s, spool); err == nil || !strings.Contains(err.Error(), "3 events spooled") {
+		t.Errorf("got error %v, expected 3 spooled events", err)
+	}
+	if len(down.requests) != 2 {
+		t.Errorf("got %d requests, expected 2 (one retry)", len(down.requests))
+	}
+	if s.sent != 0 || spoolLines(t, spool) != 6 {
+		t.Errorf("sent %d, spooled %d lines, expected 0 and 6", s.sent, spoolLines(t, spool))
+	}
+
+	// The next run sends the spool first
+	up := newTestServer(t, testResponse{http.StatusOK, `{"errors":false,"items":[]}`})
+	s = newElasticSink()
+	s.options = testSinkOptions(up.URL)
+	if err := s.Begin(spool); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.End(); err != nil {
+		t.Fatal(err)
+	}
+	if len(up.requests) != 1 || strings.Count(up.bodies[0], "\n") != 6 {
+		t.Fatalf("got %d requests, expected the 3 spooled events in one", len(up.requests))
+	}
+	for _, name := range []string{"tool.zip", "Example News", ".example.com"} {
+		if !strings.Contains(up.bodies[0], name) {
+			t.Errorf("spooled event with %s not sent", name)
+		}
+	}
+	if s.sent != 3 {
+		t.Errorf("sent %d, expected 3", s.sent)
+	}
+	for _, path := range []string{spool, spool + ".resend"} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s left after the resend", path)
+		}
+	}
+}
+
+func TestSinkResendLeftover(t *testing.T) {
+	spool := filepath.Join(t.TempDir(), "spool")
+
+	down := newTestServer(t, testResponse{http.StatusServiceUnavailable, "unavailable"})
+	s := newElasticSink()
+	s.options = testSinkOptions(down.URL)
+	writeSink(t, s, spool)
+
+	// A resend which failed leaves its file next to the spool of its own run
+	data, err := os.ReadFile(spool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(spool+".resend", data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	up := newTestServer(t, testResponse{http.StatusOK, `{"errors":false,"items":[]}`})
+	s = newElasticSink()
+	s.options = testSinkOptions(up.URL)
+	if err := s.Begin(spool); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.End(); err != nil {
+		t.Fatal(err)
+	}
+	if s.sent != 6 {
+		t.Errorf("sent %d, expected the 3 events of both files", s.sent)
+	}
+	for _, path := range []string{spool, spool + ".resend"} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s left after the resend", path)
+		}
+	}
+}
@@ -1,54 +1,102 @@
 package export
 
 import (
+	"bufio"
 	"encoding/json"
-	"fmt"
 	. "local/BrowserArtifact/src"
 	"os"
 )
 
-func ExportJSON(path string, artifacts []BrowserArtifact) {
-	// Open file
+func init() {
+	RegisterFormat(Format{Name: "json", Extension: ".json", Description: "JSON array", New: func() Exporter { return &JSONExporter{} }})
+	RegisterFormat(Format{Name: "json_line", Extension: ".jsonl", Description: "One JSON object per line", New: func() Exporter { return &JSONLineExporter{} }})
+}
+
+// JSONExporter writes artifacts to a JSON array as they come
+type JSONExporter struct {
+	file   *os.File
+	writer *bufio.Writer
+	count  int
+}
+
+func (w *JSONExporter) Begin(path string) error {
 	file, err := os.Create(path)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return err
 	}
-	defer file.Close()
 
-	jsonData, err := json.MarshalIndent(artifacts, "", "    ")
+	w.file = file
+	w.writer = bufio.NewWriter(file)
+	_, err = w.writer.WriteString("[")
+	return err
+}
+
+func (w *JSONExporter) Write(artifact BrowserArtifact) error {
+	jsonData, err := json.MarshalIndent(artifact, "    ", "    ")
 	if err != nil {
-		fmt.Println(err)
-		return
+		return err
 	}
 
-	// Write JSON data to file
-	_, err = file.Write(jsonData)
-	if err != nil {
-		return
+	separator := ",\n    "
+	if w.count == 0 {
+		separator = "\n    "
+	}
+	w.count++
+	if _, err := w.writer.WriteString(separator); err != nil {
+		return err
 	}
+	_, err = w.writer.Write(jsonData)
+	return err
 }
 
-func ExportJSONLine(path string, artifacts []BrowserArtifact) {
-	// Open file
+func (w *JSONExporter) End() error {
+	end := "\n]"
+	if w.count == 0 {
+		end = "]"
+	}
+	if _, err := w.writer.WriteString(end); err != nil {
+		w.file.Close()
+		return err
+	}
+	if err := w.writer.Flush(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+// JSONLineExporter writes one JSON artifact per line
+type JSONLineExporter struct {
+	file   *os.File
+	writer *bufio.Writer
+}
+
+func (w *JSONLineExporter) Begin(path string) error {
 	file, err := os.Create(path)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return err
+	}
+
+	w.file = file
+	w.writer = bufio.NewWriter(file)
+	return nil
+}
+
+func (w *JSONLineExporter) Write(artifact BrowserArtifact) error {
+	jsonData, err := json.Marshal(artifact)
+	if err != nil {
+		return err
 	}
-	defer file.Close()
 
-	// Write JSON data to file
-	for _, artifact := range artifacts {
-		jsonData, err := json.Marshal(artifact)
-		if err != nil {
-			fmt.Println(err)
-			return
-		}
+	jsonData = append(jsonData, '\n')
+	_, err = w.writer.Write(jsonData)
+	return err
+}
 
-		_, err = file.Write(jsonData)
-		if err != nil {
-			return
-		}
+func (w *JSONLineExporter) End() error {
+	if err := w.writer.Flush(); err != nil {
+		w.file.Close()
+		return err
 	}
+	return w.file.Close()
 }
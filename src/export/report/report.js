@@ -0,0 +1,97 @@
+(function () {
+	var artifacts = JSON.parse(document.getElementById("artifacts").textContent);
+	var pageSize = 500;
+	var page = 0;
+	var filtered = artifacts;
+
+	var search = document.getElementById("search");
+	var type = document.getElementById("type");
+	var from = document.getElementById("from");
+	var to = document.getElementById("to");
+	var body = document.getElementById("timeline-body");
+	var status = document.getElementById("timeline-status");
+
+	function text(artifact) {
+		return [artifact.url, artifact.title, artifact.filename, artifact.cookie, artifact.addon_name, artifact.value]
+			.filter(function (value) { return value; }).join(" | ");
+	}
+
+	function cell(row, value, className) {
+		var td = document.createElement("td");
+		td.textContent = value === undefined ? "" : value;
+		if (className) {
+			td.className = className;
+		}
+		row.appendChild(td);
+	}
+
+	function render() {
+		body.textContent = "";
+		var start = page * pageSize;
+		filtered.slice(start, start + pageSize).forEach(function (artifact) {
+			var row = document.createElement("tr");
+			if (artifact.recovery) {
+				row.className = "recovered";
+			}
+			cell(row, artifact.time);
+			cell(row, artifact.artifact_type);
+			cell(row, artifact.timestamp_type);
+			cell(row, artifact.user);
+			cell(row, [artifact.app, artifact.browser_profile].filter(Boolean).join(" / "));
+			cell(row, text(artifact), "url");
+			cell(row, [artifact.recovery, artifact.timestamp_warning].filter(Boolean).join(", "), "warning");
+			body.appendChild(row);
+		});
+		var pages = Math.max(1, Math.ceil(filtered.length / pageSize));
+		status.textContent = filtered.length + " of " + artifacts.length + " artifacts, page " + (page + 1) + " of " + pages;
+	}
+
+	function filter() {
+		var words = search.value.toLowerCase().split(/\s+/).filter(Boolean);
+		var selected = type.value;
+		var start = from.value;
+		var end = to.value ? to.value + "T23:59:59.999999Z" : "";
+		filtered = artifacts.filter(function (artifact) {
+			if (selected && artifact.artifact_type !== selected) {
+				return false;
+			}
+			var time = artifact.time || "";
+			if (start && time < start) {
+				return false;
+			}
+			if (end && time > end) {
+				return false;
+			}
+			if (words.length) {
+				var haystack = JSON.stringify(artifact).toLowerCase();
+				return words.every(function (word) { return haystack.indexOf(word) !== -1; });
+			}
+			return true;
+		});
+		page = 0;
+		render();
+	}
+
+	var timer;
+	search.addEventListener("input", function () {
+		clearTimeout(timer);
+		timer = setTimeout(filter, 200);
+	});
+	type.addEventListener("change", filter);
+	from.addEventListener("change", filter);
+	to.addEventListener("change", filter);
+	document.getElementById("previous").addEventListener("click", function () {
+		if (page > 0) {
+			page--;
+			render();
+		}
+	});
+	document.getElementById("next").addEventListener("click", function () {
+		if ((page + 1) * pageSize < filtered.length) {
+			page++;
+			render();
+		}
+	});
+
+	render();
+})();
@@ -0,0 +1,303 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	. "local/BrowserArtifact/src"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+/**
+ * Schemas of the SIEMs, written one JSON event per line: Elastic Common Schema (ecs_json) and the
+ * Open Cybersecurity Schema Framework (ocsf_json). The mapping of the fields is documented in the README.
+ */
+
+const (
+	ecsVersion  = "8.11.0"
+	ocsfVersion = "1.1.0"
+)
+
+func init() {
+	RegisterFormat(Format{Name: "ecs_json", Extension: ".ecs.jsonl", Description: "Elastic Common Schema, one event per line", New: func() Exporter { return &ECSExporter{} }})
+	RegisterFormat(Format{Name: "ocsf_json", Extension: ".ocsf.jsonl", Description: "OCSF Web Resources Activity, one event per line", New: func() Exporter { return &OCSFExporter{} }})
+}
+
+// event is a JSON event built from dotted field names, empty values are left out
+type event map[string]interface{}
+
+func (e event) set(field string, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return
+		}
+	case int:
+		if v == 0 {
+			return
+		}
+	case int64:
+		if v == 0 {
+			return
+		}
+	case float32:
+		if v == 0 {
+			return
+		}
+	case bool:
+		if !v {
+			return
+		}
+	case []string:
+		if len(v) == 0 {
+			return
+		}
+	}
+
+	names := strings.Split(field, ".")
+	current := e
+	for _, name := range names[:len(names)-1] {
+		next, ok := current[name].(event)
+		if !ok {
+			next = event{}
+			current[name] = next
+		}
+		current = next
+	}
+	current[names[len(names)-1]] = value
+}
+
+// eventWriter writes one JSON event per line
+type eventWriter struct {
+	file   *os.File
+	writer *bufio.Writer
+}
+
+func (w *eventWriter) Begin(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	w.file = file
+	w.writer = bufio.NewWriter(file)
+	return nil
+}
+
+func (w *eventWriter) writeEvent(e event) error {
+	jsonData, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	jsonData = append(jsonData, '\n')
+	_, err = w.writer.Write(jsonData)
+	return err
+}
+
+func (w *eventWriter) End() error {
+	if err := w.writer.Flush(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+// fullURL tells if the Url of the artifact is a URL, cookies and logins of Firefox hold a host
+func fullURL(artifact BrowserArtifact) bool {
+	return strings.Contains(artifact.Url, "://") || strings.HasPrefix(artifact.Url, "about:") ||
+		strings.HasPrefix(artifact.Url, "data:") || strings.HasPrefix(artifact.Url, "file:")
+}
+
+// The fields of the artifact not in the schema
+func browserFields(e event, prefix string, artifact BrowserArtifact) {
+	e.set(prefix+"artifact_type", artifact.ArtifactType)
+	e.set(prefix+"browser", artifact.App)
+	e.set(prefix+"profile", artifact.BrowserProfile)
+	e.set(prefix+"profile_name", artifact.BrowserProfileName)
+	e.set(prefix+"account", artifact.BrowserAccount)
+	e.set(prefix+"profile_default", artifact.BrowserProfileDefault)
+	e.set(prefix+"install", artifact.BrowserInstall)
+	e.set(prefix+"timestamp_type", artifact.TimestampType)
+	e.set(prefix+"timestamp_raw", artifact.TimestampRaw)
+	e.set(prefix+"timestamp_epoch", artifact.TimestampEpoch)
+	e.set(prefix+"timestamp_warning", artifact.TimestampWarning)
+	e.set(prefix+"recovery", artifact.Recovery)
+	e.set(prefix+"confidence", artifact.Confidence)
+	e.set(prefix+"title", artifact.Title)
+	e.set(prefix+"visit_count", artifact.VisitCount)
+	e.set(prefix+"typed", artifact.Typed)
+	e.set(prefix+"transition", artifact.Transition)
+	e.set(prefix+"cookie", artifact.Cookie)
+	e.set(prefix+"bookmark_title", artifact.BookmarkTitle)
+	e.set(prefix+"bookmark_folder", artifact.BookmarkFolder)
+	e.set(prefix+"session_window", artifact.SessionWindow)
+	e.set(prefix+"session_tab", artifact.SessionTab)
+	e.set(prefix+"navigation_index", artifact.NavigationIndex)
+	e.set(prefix+"field_name", artifact.Fieldname)
+	e.set(prefix+"field_value", artifact.Value)
+	e.set(prefix+"metadata", artifact.Metadata)
+	e.set(prefix+"cached", artifact.Cached)
+}
+
+// ECSExporter writes Elastic Common Schema events
+type ECSExporter struct {
+	eventWriter
+}
+
+// ecsCategory returns the event categories of an artifact type
+func ecsCategory(artifactType string) []string {
+	switch artifactType {
+	case "download":
+		return []string{"file", "web"}
+	case "extension", "addon":
+		return []string{"package"}
+	}
+	return []string{"web"}
+}
+
+// ecsType returns the event type allowed for the category from the MACB letter of the timestamp type
+func ecsType(category string, timestampType string) string {
+	letter := macb(timestampType)
+	switch {
+	case letter == "A":
+		return "access"
+	case category == "file" && letter == "B":
+		return "creation"
+	case category == "file" && letter == "M":
+		return "change"
+	case category == "package" && letter == "B":
+		return "installation"
+	case category == "package" && letter == "M":
+		return "change"
+	}
+	return "info"
+}
+
+func (w *ECSExporter) Write(artifact BrowserArtifact) error {
+	return w.writeEvent(ecsEvent(artifact))
+}
+
+// ecsEvent maps an artifact to an ECS event
+func ecsEvent(artifact BrowserArtifact) event {
+	category := ecsCategory(artifact.ArtifactType)
+
+	e := event{}
+	e.set("@timestamp", FormatTime(artifact.Time))
+	e.set("message", timelineDescription(artifact))
+	e.set("ecs.version", ecsVersion)
+	e.set("event.kind", "event")
+	e.set("event.category", category)
+	e.set("event.type", []string{ecsType(category[0], artifact.TimestampType)})
+	e.set("event.action", artifact.ArtifactType)
+	e.set("event.dataset", "browser."+artifact.ArtifactType)
+	e.set("event.module", "browserartifact")
+	e.set("event.provider", artifact.App)
+	e.set("event.duration", int64(artifact.Duration)*1000) // Microseconds to nanoseconds
+
+	if fullURL(artifact) {
+		e.set("url.full", artifact.Url)
+		e.set("url.original", artifact.Url)
+	}
+	e.set("url.domain", artifact.UrlDomain)
+	e.set("user.name", artifact.User)
+	e.set("user_agent.name", artifact.App)
+	e.set("user_agent.original", artifact.HttpUserAgent)
+
+	e.set("http.request.method", artifact.HttpMethod)
+	e.set("http.request.referrer", artifact.HttpReferrer)
+	e.set("http.response.mime_type", artifact.HttpContentType)
+	if status, err := strconv.Atoi(artifact.Status); err == nil {
+		e.set("http.response.status_code", status)
+	}
+	e.set("source.address", artifact.Src)
+	e.set("destination.address", artifact.Dest)
+	e.set("destination.port", artifact.DestPort)
+
+	if artifact.Filename != "" {
+		e.set("file.path", artifact.Filename)
+		e.set("file.name", filepath.Base(strings.ReplaceAll(artifact.Filename, "\\", "/")))
+		e.set("file.mime_type", artifact.MimeType)
+		e.set("file.size", artifact.BytesIn+artifact.BytesOut)
+	}
+
+	if category[0] == "package" {
+		e.set("package.name", artifact.AddonName)
+		e.set("package.version", artifact.Version)
+		e.set("package.type", artifact.AddonType)
+		e.set("package.description", artifact.Description)
+		e.set("package.reference", artifact.HomePageURL)
+	}
+
+	browserFields(e, "browser_artifact.", artifact)
+	return e
+}
+
+// OCSFExporter writes OCSF Web Resources Activity events
+type OCSFExporter struct {
+	eventWriter
+}
+
+// Activities of the Web Resources Activity class by MACB letter
+var ocsfActivities = map[string]struct {
+	id   int
+	name string
+}{
+	"B": {1, "Create"},
+	"A": {2, "Read"},
+	"M": {3, "Update"},
+	"":  {99, "Other"},
+}
+
+func (w *OCSFExporter) Write(artifact BrowserArtifact) error {
+	const classUID = 6001
+	activity, ok := ocsfActivities[macb(artifact.TimestampType)]
+	if !ok {
+		activity = ocsfActivities[""]
+	}
+
+	e := event{}
+	if !artifact.Time.IsZero() {
+		e.set("time", artifact.Time.UnixMilli())
+	}
+	e.set("message", timelineDescription(artifact))
+	e.set("category_uid", 6)
+	e.set("category_name", "Application Activity")
+	e.set("class_uid", classUID)
+	e.set("class_name", "Web Resources Activity")
+	e.set("activity_id", activity.id)
+	e.set("activity_name", activity.name)
+	e.set("type_uid", classUID*100+activity.id)
+	e.set("type_name", "Web Resources Activity: "+activity.name)
+	e.set("severity_id", 1)
+	e.set("severity", "Informational")
+
+	e.set("metadata.version", ocsfVersion)
+	e.set("metadata.product.name", "BrowserArtifact")
+	e.set("metadata.product.vendor_name", "BrowserArtifact")
+	e.set("metadata.product.version", Version)
+	e.set("metadata.log_name", artifact.ArtifactType)
+	e.set("metadata.log_provider", artifact.App)
+
+	e.set("actor.user.name", artifact.User)
+	e.set("actor.app_name", artifact.App)
+
+	resource := event{}
+	resource.set("type", artifact.ArtifactType)
+	resource.set("name", timelineShort(artifact))
+	if fullURL(artifact) {
+		resource.set("url_string", artifact.Url)
+	}
+	resource.set("desc", artifact.Title)
+	e.set("web_resources", []event{resource})
+
+	e.set("unmapped.url_domain", artifact.UrlDomain)
+	e.set("unmapped.file_path", artifact.Filename)
+	e.set("unmapped.mime_type", artifact.MimeType)
+	e.set("unmapped.http_referrer", artifact.HttpReferrer)
+	e.set("unmapped.bytes", artifact.BytesIn+artifact.BytesOut)
+	browserFields(e, "unmapped.", artifact)
+	return w.writeEvent(e)
+}
@@ -0,0 +1,108 @@
+package export
+
+import (
+	"bytes"
+	"flag"
+	. "local/BrowserArtifact/src"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "Rewrite the golden files of the tests")
+
+// testArtifacts returns a visit, a download and a cookie as the extractors tag them
+func testArtifacts() []BrowserArtifact {
+	visit := BrowserArtifact{
+		ArtifactType:       "chrome_history",
+		User:               "alice",
+		App:                "chrome",
+		Url:                "https://example.com/news?id=1",
+		UrlDomain:          "example.com",
+		Title:              "Example News",
+		VisitCount:         3,
+		Typed:              1,
+		Transition:         "typed",
+		Duration:           1500000,
+		BrowserProfile:     "Default",
+		BrowserProfileName: "Person 1",
+		TimestampType:      "visit_date",
+	}
+	visit.SetTimestamp(13340000000000000, EpochWebKit)
+
+	download := BrowserArtifact{
+		ArtifactType:   "download",
+		User:           "alice",
+		App:            "firefox",
+		Url:            "https://downloads.example.org/tool.zip",
+		UrlDomain:      "downloads.example.org",
+		HttpReferrer:   "https://example.org/",
+		Filename:       "C:\\Users\\alice\\Downloads\\tool.zip",
+		MimeType:       "application/zip",
+		BytesIn:        52428,
+		BrowserProfile: "abc.default",
+		TimestampType:  "dateAdded",
+	}
+	download.SetTimestamp(1700000000000000, EpochUnixMicroseconds)
+
+	cookie := BrowserArtifact{
+		ArtifactType:          "cookie",
+		User:                  "alice",
+		App:                   "firefox",
+		Url:                   ".example.com",
+		UrlDomain:             "example.com",
+		Cookie:                "session=\"a b\"",
+		BrowserProfile:        "abc.default",
+		BrowserProfileDefault: true,
+		BrowserInstall:        "308046B0AF4A39CB",
+		Recovery:              "wal",
+		TimestampType:         "creationTime",
+	}
+	cookie.SetTimestamp(1700000100000000, EpochUnixMicroseconds)
+
+	return []BrowserArtifact{visit, download, cookie}
+}
+
+// exportGolden writes the test artifacts with the exporter and compares the file with testdata/golden
+func exportGolden(t *testing.T, exporter Exporter, golden string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "artifacts")
+	if err := exporter.Begin(path); err != nil {
+		t.Fatal(err)
+	}
+	for _, artifact := range testArtifacts() {
+		if err := exporter.Write(artifact); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := exporter.End(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	goldenPath := filepath.Join("testdata", golden)
+	if *update {
+		if err := os.WriteFile(goldenPath, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := os.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, expected) {
+		t.Errorf("output differs from %s, run go test -update to rewrite it:\n%s", goldenPath, got)
+	}
+}
+
+func TestECSGolden(t *testing.T) {
+	exportGolden(t, &ECSExporter{}, "ecs.jsonl")
+}
+
+func TestOCSFGolden(t *testing.T) {
+	exportGolden(t, &OCSFExporter{}, "ocsf.jsonl")
+}
@@ -0,0 +1,285 @@
+package export
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	. "local/BrowserArtifact/src"
+	"os"
+	"time"
+)
+
+/**
+ * Sinks sending the artifacts in batches to a remote endpoint.
+ * A batch which cannot be delivered after the retries is appended to the spool file, the path given to Begin, and
+ * the endpoint is considered down for the rest of the run. The spool is sent first by the next run with the same
+ * output path.
+ */
+
+type TLSOptions struct {
+	CAFile   string // PEM certificates trusted in addition to the system ones
+	CertFile string // PEM client certificate
+	KeyFile  string // PEM key of the client certificate
+	Insecure bool   // Do not verify the certificate of the server
+}
+
+type SinkOptions struct {
+	URL       string
+	Token     string
+	Index     string
+	BatchSize int
+	Retries   int
+	Backoff   time.Duration // Doubled at each retry
+	Timeout   time.Duration
+}
+
+// TLS options of the sinks, set from the command line
+var SinkTLS TLSOptions
+
+// Longest wait between two retries
+const maximumBackoff = time.Minute
+
+// TLSConfig builds the TLS configuration of the options
+func TLSConfig(options TLSOptions) (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: options.Insecure}
+
+	if options.CAFile != "" {
+		pem, err := os.ReadFile(options.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificate found in " + options.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if options.CertFile != "" || options.KeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(options.CertFile, options.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	return config, nil
+}
+
+// permanentError is an error retrying will not fix, e.g. a rejected token
+type permanentError struct {
+	error
+}
+
+// sink batches events and delivers them, an event is one or more lines ending with a newline
+type sink struct {
+	name    string
+	options *SinkOptions
+
+	// connect prepares the connection to the endpoint, disconnect closes it
+	connect    func() error
+	disconnect func()
+	// deliver sends events, returning the events to send again, and adds the events refused for good to rejected
+	deliver func(events [][]byte) ([][]byte, error)
+	// encode returns the event of an artifact
+	encode func(artifact BrowserArtifact) ([]byte, error)
+	// Lines of an event in the spool
+	eventLines int
+
+	batch     [][]byte
+	down      bool
+	spoolPath string
+	spool     *os.File
+	sent      int
+	spooled   int
+	rejected  int
+}
+
+func (s *sink) Begin(path string) error {
+	if s.options.URL == "" {
+		return fmt.Errorf("no URL given to the %s output", s.name)
+	}
+
+	if err := s.connect(); err != nil {
+		return err
+	}
+	s.spoolPath = path
+
+	// Events spooled by a previous run are sent first, those failing again go to the new spool.
+	// The resend file is only removed once read, a resend which failed or was interrupted is done again.
+	resend := path + ".resend"
+	if _, err := os.Stat(path); err == nil {
+		if err := appendFile(resend, path); err != nil {
+			return err
+		}
+	}
+	if _, err := os.Stat(resend); err == nil {
+		log("info", s.name, "Sending events spooled in "+path)
+		if err := s.resend(resend); err != nil {
+			return err
+		}
+		return os.Remove(resend)
+	}
+	return nil
+}
+
+// appendFile moves the content of source to the end of destination
+func appendFile(destination string, source string) error {
+	if _, err := os.Stat(destination); os.IsNotExist(err) {
+		return os.Rename(source, destination)
+	}
+	data, err := os.ReadFile(source)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(destination, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Remove(source)
+}
+
+// resend queues the events of a spool file
+func (s *sink) resend(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var event []byte
+	lines := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			event = append(event, line...)
+			lines++
+			if lines == s.eventLines {
+				if err := s.queue(event); err != nil {
+					return err
+				}
+				event = nil
+				lines = 0
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *sink) Write(artifact BrowserArtifact) error {
+	event, err := s.encode(artifact)
+	if err != nil {
+		return err
+	}
+	return s.queue(event)
+}
+
+func (s *sink) queue(event []byte) error {
+	s.batch = append(s.batch, event)
+	if len(s.batch) >= s.options.BatchSize {
+		return s.flush()
+	}
+	return nil
+}
+
+// flush posts the batch with retries, spooling it when the endpoint cannot be reached
+func (s *sink) flush() error {
+	events := s.batch
+	s.batch = nil
+	if len(events) == 0 {
+		return nil
+	}
+	if s.down {
+		return s.spoolEvents(events)
+	}
+
+	backoff := s.options.Backoff
+	for attempt := 0; ; attempt++ {
+		// Events rejected by the endpoint are counted by deliver, they are neither sent nor sent again
+		rejected := s.rejected
+		retry, err := s.deliver(events)
+		rejected = s.rejected - rejected
+		if err == nil && len(retry) == 0 {
+			s.sent += len(events) - rejected
+			return nil
+		}
+		if retry != nil {
+			s.sent += len(events) - len(retry) - rejected
+			events = retry
+		}
+		if err == nil {
+			err = fmt.Errorf("%d events not accepted", len(retry))
+		}
+
+		var permanent permanentError
+		if errors.As(err, &permanent) || attempt >= s.options.Retries {
+			log("error", s.name, fmt.Sprintf("Endpoint unreachable, spooling to %s: %s", s.spoolPath, err.Error()))
+			s.down = true
+			return s.spoolEvents(events)
+		}
+		log("warn", s.name, fmt.Sprintf("Sending failed, retrying in %s: %s", backoff, err.Error()))
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maximumBackoff {
+			backoff = maximumBackoff
+		}
+	}
+}
+
+func (s *sink) spoolEvents(events [][]byte) error {
+	if s.spool == nil {
+		spool, err := os.OpenFile(s.spoolPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+		s.spool = spool
+	}
+	for _, event := range events {
+		if _, err := s.spool.Write(event); err != nil {
+			return err
+		}
+	}
+	s.spooled += len(events)
+	return nil
+}
+
+func (s *sink) End() error {
+	err := s.flush()
+	if s.disconnect != nil {
+		s.disconnect()
+	}
+	if s.spool != nil {
+		if closeErr := s.spool.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	log("info", s.name, fmt.Sprintf("Sent %d events (%d rejected), spooled %d", s.sent, s.rejected, s.spooled))
+
+	if err != nil {
+		return err
+	}
+	if s.spooled > 0 {
+		return fmt.Errorf("%d events spooled to %s, they are sent by the next run", s.spooled, s.spoolPath)
+	}
+	if s.rejected > 0 {
+		return fmt.Errorf("%d events rejected by the endpoint", s.rejected)
+	}
+	return nil
+}
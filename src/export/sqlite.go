@@ -0,0 +1,225 @@
+package export
+
+import (
+	"database/sql"
+	"encoding/json"
+	. "local/BrowserArtifact/src"
+	"os"
+	"sort"
+	"strings"
+)
+
+/**
+ * SQLite database with one row per artifact in the artifacts table, the fields of cookies, downloads, logins and
+ * extensions in typed side tables referencing it, and the description of the run in run_metadata.
+ */
+
+func init() {
+	RegisterFormat(Format{Name: "sqlite", Extension: ".sqlite", Description: "SQLite database with an artifacts table and typed side tables", New: func() Exporter { return &SQLiteExporter{} }})
+}
+
+var sqliteSchema = []string{
+	`CREATE TABLE artifacts (
+		id INTEGER PRIMARY KEY,
+		artifact_type TEXT,
+		time TEXT,
+		timestamp INTEGER,
+		timestamp_type TEXT,
+		timestamp_raw INTEGER,
+		timestamp_epoch TEXT,
+		timestamp_warning TEXT,
+		user TEXT,
+		app TEXT,
+		browser_profile TEXT,
+		browser_profile_name TEXT,
+		browser_account TEXT,
+		browser_profile_default INTEGER,
+		browser_install TEXT,
+		url TEXT,
+		url_domain TEXT,
+		title TEXT,
+		action TEXT,
+		src TEXT,
+		dest TEXT,
+		status TEXT,
+		recovery TEXT,
+		confidence TEXT,
+		data TEXT
+	)`,
+	`CREATE TABLE cookies (
+		artifact_id INTEGER REFERENCES artifacts(id),
+		host TEXT,
+		name TEXT,
+		value TEXT,
+		port INTEGER
+	)`,
+	`CREATE TABLE downloads (
+		artifact_id INTEGER REFERENCES artifacts(id),
+		url TEXT,
+		referrer TEXT,
+		filename TEXT,
+		mime_type TEXT,
+		received_bytes INTEGER,
+		total_bytes INTEGER,
+		duration INTEGER,
+		metadata TEXT
+	)`,
+	`CREATE TABLE logins (
+		artifact_id INTEGER REFERENCES artifacts(id),
+		url TEXT,
+		username TEXT
+	)`,
+	`CREATE TABLE extensions (
+		artifact_id INTEGER REFERENCES artifacts(id),
+		name TEXT,
+		type TEXT,
+		version TEXT,
+		active INTEGER,
+		visible INTEGER,
+		description TEXT,
+		creator_name TEXT,
+		source_uri TEXT,
+		home_page_url TEXT
+	)`,
+	`CREATE TABLE run_metadata (
+		key TEXT PRIMARY KEY,
+		value TEXT
+	)`,
+}
+
+// Indexes are created once the rows are inserted
+var sqliteIndexes = []string{
+	"CREATE INDEX artifacts_timestamp ON artifacts(timestamp)",
+	"CREATE INDEX artifacts_url ON artifacts(url)",
+	"CREATE INDEX artifacts_url_domain ON artifacts(url_domain)",
+	"CREATE INDEX artifacts_user ON artifacts(user)",
+	"CREATE INDEX artifacts_app ON artifacts(app)",
+	"CREATE INDEX artifacts_artifact_type ON artifacts(artifact_type)",
+	"CREATE INDEX cookies_artifact_id ON cookies(artifact_id)",
+	"CREATE INDEX downloads_artifact_id ON downloads(artifact_id)",
+	"CREATE INDEX logins_artifact_id ON logins(artifact_id)",
+	"CREATE INDEX extensions_artifact_id ON extensions(artifact_id)",
+}
+
+var sqliteInserts = map[string]string{
+	"artifacts":  "INSERT INTO artifacts VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+	"cookies":    "INSERT INTO cookies VALUES (?, ?, ?, ?, ?)",
+	"downloads":  "INSERT INTO downloads VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+	"logins":     "INSERT INTO logins VALUES (?, ?, ?)",
+	"extensions": "INSERT INTO extensions VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+}
+
+// SQLiteExporter writes artifacts to a new SQLite database in a single transaction
+type SQLiteExporter struct {
+	db         *sql.DB
+	tx         *sql.Tx
+	statements map[string]*sql.Stmt
+	id         int64
+}
+
+func (w *SQLiteExporter) Begin(path string) error {
+	// The database is created anew like the files of the other formats
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	w.db = db
+
+	for _, query := range append([]string{"PRAGMA synchronous = OFF"}, sqliteSchema...) {
+		if _, err := db.Exec(query); err != nil {
+			db.Close()
+			return err
+		}
+	}
+
+	if w.tx, err = db.Begin(); err != nil {
+		db.Close()
+		return err
+	}
+	w.statements = map[string]*sql.Stmt{}
+	for table, query := range sqliteInserts {
+		if w.statements[table], err = w.tx.Prepare(query); err != nil {
+			w.tx.Rollback()
+			db.Close()
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *SQLiteExporter) Write(artifact BrowserArtifact) error {
+	data, err := json.Marshal(artifact)
+	if err != nil {
+		return err
+	}
+
+	w.id++
+	_, err = w.statements["artifacts"].Exec(w.id, artifact.ArtifactType, FormatTime(artifact.Time), artifact.Timestamp,
+		artifact.TimestampType, artifact.TimestampRaw, artifact.TimestampEpoch, artifact.TimestampWarning, artifact.User,
+		artifact.App, artifact.BrowserProfile, artifact.BrowserProfileName, artifact.BrowserAccount,
+		artifact.BrowserProfileDefault, artifact.BrowserInstall, artifact.Url,
+		artifact.UrlDomain, artifact.Title, artifact.Action, artifact.Src, artifact.Dest, artifact.Status,
+		artifact.Recovery, artifact.Confidence, string(data))
+	if err != nil {
+		return err
+	}
+
+	switch artifact.ArtifactType {
+	case "cookie", "session_cookie":
+		name, value, _ := strings.Cut(artifact.Cookie, "=")
+		_, err = w.statements["cookies"].Exec(w.id, artifact.Url, name, value, artifact.DestPort)
+	case "download":
+		_, err = w.statements["downloads"].Exec(w.id, artifact.Url, artifact.HttpReferrer, artifact.Filename, artifact.MimeType,
+			artifact.BytesIn, artifact.BytesIn+artifact.BytesOut, artifact.Duration, artifact.Metadata)
+	case "login":
+		username := ""
+		if artifact.Fieldname == "username" {
+			username = artifact.Value
+		}
+		_, err = w.statements["logins"].Exec(w.id, artifact.Url, username)
+	case "extension", "addon":
+		_, err = w.statements["extensions"].Exec(w.id, artifact.AddonName, artifact.AddonType, artifact.Version,
+			artifact.Active, artifact.Visible, artifact.Description, artifact.CreatorName, artifact.SourceURI,
+			artifact.HomePageURL)
+	}
+	return err
+}
+
+func (w *SQLiteExporter) End() error {
+	var keys []string
+	for key := range RunMetadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var err error
+	for _, key := range keys {
+		if _, err = w.tx.Exec("INSERT INTO run_metadata VALUES (?, ?)", key, RunMetadata[key]); err != nil {
+			break
+		}
+	}
+	for _, index := range sqliteIndexes {
+		if err != nil {
+			break
+		}
+		_, err = w.tx.Exec(index)
+	}
+
+	for _, statement := range w.statements {
+		statement.Close()
+	}
+	if err != nil {
+		w.tx.Rollback()
+		w.db.Close()
+		return err
+	}
+	if err := w.tx.Commit(); err != nil {
+		w.db.Close()
+		return err
+	}
+	return w.db.Close()
+}
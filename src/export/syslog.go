@@ -0,0 +1,312 @@
+package export
+
+import (
+	"crypto/tls"
+	"fmt"
+	. "local/BrowserArtifact/src"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+/**
+ * Sinks sending each artifact as a syslog message (RFC 5424) over UDP, TCP or TLS, the artifact being written as
+ * structured data (syslog), or as the message in ArcSight CEF (cef) or QRadar LEEF (leef).
+ * Fields are named after the json tags of BrowserArtifact, CEF and LEEF use their own keys where they have one.
+ * The connection is opened again when a message cannot be written, messages are paced by SyslogRate.
+ */
+
+func init() {
+	RegisterFormat(Format{Name: "syslog", Extension: ".syslog.spool", Description: "RFC 5424 syslog with structured data (-syslog_url)", Sink: true, New: func() Exporter { return newSyslogSink("syslog", syslogStructured) }})
+	RegisterFormat(Format{Name: "cef", Extension: ".cef.spool", Description: "ArcSight CEF over syslog (-syslog_url)", Sink: true, New: func() Exporter { return newSyslogSink("cef", syslogCEF) }})
+	RegisterFormat(Format{Name: "leef", Extension: ".leef.spool", Description: "QRadar LEEF over syslog (-syslog_url)", Sink: true, New: func() Exporter { return newSyslogSink("leef", syslogLEEF) }})
+}
+
+// Options of the syslog sinks, set from the command line
+var (
+	SyslogSink    = SinkOptions{BatchSize: 500, Retries: 5, Backoff: time.Second, Timeout: 10 * time.Second}
+	SyslogRate    = 0       // Messages per second, 0 for no limit
+	SyslogFraming = "octet" // TCP and TLS framing: octet (counting, RFC 6587) or newline
+)
+
+const (
+	syslogPriority = 1*8 + 6 // Facility user, severity informational
+	syslogApp      = "BrowserArtifact"
+	// SD-ID of the structured data, 32473 is the enterprise number reserved for documentation (RFC 5612)
+	syslogSDID = "artifact@32473"
+)
+
+// CEF and LEEF keys of the fields, other fields keep their json name
+var (
+	cefKeys = map[string]string{
+		"time":            "rt",
+		"artifact_type":   "cat",
+		"src":             "src",
+		"dest":            "dst",
+		"dest_port":       "dpt",
+		"user":            "suser",
+		"app":             "browser",
+		"action":          "act",
+		"url":             "request",
+		"url_domain":      "dhost",
+		"http_method":     "requestMethod",
+		"http_referrer":   "requestContext",
+		"http_user_agent": "requestClientApplication",
+		"cookie":          "requestCookies",
+		"bytes_in":        "in",
+		"bytes_out":       "out",
+		"filename":        "fname",
+		"mime_type":       "fileType",
+	}
+	leefKeys = map[string]string{
+		"time":          "devTime",
+		"artifact_type": "cat",
+		"src":           "src",
+		"dest":          "dst",
+		"dest_port":     "dstPort",
+		"user":          "usrName",
+	}
+)
+
+// artifactFields returns the fields set in the artifact named by their json tag, in the order of the struct
+func artifactFields(artifact BrowserArtifact) [][2]string {
+	var fields [][2]string
+	if !artifact.Time.IsZero() {
+		fields = append(fields, [2]string{"time", FormatTime(artifact.Time)})
+	}
+
+	value := reflect.ValueOf(artifact)
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" || value.Field(i).IsZero() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, [2]string{name, fmt.Sprint(value.Field(i).Interface())})
+	}
+	return fields
+}
+
+// oneLine replaces the line breaks, a message is one line of the spool
+func oneLine(value string) string {
+	return strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ").Replace(value)
+}
+
+// syslogHeader returns the header of a message: <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID
+func syslogHeader(artifact BrowserArtifact) string {
+	timestamp := "-"
+	if !artifact.Time.IsZero() {
+		timestamp = artifact.Time.UTC().Format("2006-01-02T15:04:05.000000Z")
+	}
+	hostname := RunMetadata["hostname"]
+	if hostname == "" {
+		hostname = "-"
+	}
+	msgid := artifact.ArtifactType
+	if msgid == "" {
+		msgid = "-"
+	}
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s", syslogPriority, timestamp, hostname, syslogApp, os.Getpid(), msgid)
+}
+
+// syslogStructured writes the fields as structured data and the description as message
+func syslogStructured(artifact BrowserArtifact) string {
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+	data := "[" + syslogSDID
+	for _, field := range artifactFields(artifact) {
+		data += fmt.Sprintf(` %s="%s"`, field[0], escape.Replace(oneLine(field[1])))
+	}
+	data += "]"
+	return syslogHeader(artifact) + " " + data + " " + timelineDescription(artifact)
+}
+
+// syslogCEF writes the message CEF:Version|Vendor|Product|Version|Signature|Name|Severity|Extension
+func syslogCEF(artifact BrowserArtifact) string {
+	header := strings.NewReplacer(`\`, `\\`, `|`, `\|`)
+	value := strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r\n", `\n`, "\n", `\n`, "\r", `\r`)
+
+	var extension []string
+	for _, field := range artifactFields(artifact) {
+		key, ok := cefKeys[field[0]]
+		if !ok {
+			key = field[0]
+		}
+		if key == "rt" {
+			field[1] = fmt.Sprint(artifact.Time.UnixMilli())
+		}
+		extension = append(extension, key+"="+value.Replace(field[1]))
+	}
+
+	name := strings.TrimSpace(artifact.ArtifactType + " " + artifact.TimestampType)
+	return syslogHeader(artifact) + " - " + fmt.Sprintf("CEF:0|%s|%s|%s|%s|%s|1|%s", syslogApp, syslogApp,
+		header.Replace(Version), header.Replace(oneLine(artifact.ArtifactType)), header.Replace(oneLine(name)),
+		strings.Join(extension, " "))
+}
+
+// syslogLEEF writes the message LEEF:1.0|Vendor|Product|Version|EventID|Attributes, attributes separated by tabs
+func syslogLEEF(artifact BrowserArtifact) string {
+	header := strings.NewReplacer(`|`, `\|`)
+	value := strings.NewReplacer("\t", " ", "\r\n", " ", "\n", " ", "\r", " ")
+
+	var attributes []string
+	for _, field := range artifactFields(artifact) {
+		key, ok := leefKeys[field[0]]
+		if !ok {
+			key = field[0]
+		}
+		if key == "devTime" {
+			attributes = append(attributes, "devTimeFormat=MMM dd yyyy HH:mm:ss.SSS z")
+			field[1] = artifact.Time.UTC().Format("Jan 02 2006 15:04:05.000") + " UTC"
+		}
+		attributes = append(attributes, key+"="+value.Replace(field[1]))
+	}
+
+	return syslogHeader(artifact) + " - " + fmt.Sprintf("LEEF:1.0|%s|%s|%s|%s|%s", syslogApp, syslogApp,
+		header.Replace(Version), header.Replace(oneLine(artifact.ArtifactType)), strings.Join(attributes, "\t"))
+}
+
+type syslogSink struct {
+	*sink
+	network string // udp, tcp or tls
+	address string
+	conn    net.Conn
+	closed  chan struct{} // Closed when the collector closes the connection
+	next    time.Time     // Time the next message can be sent at
+}
+
+func newSyslogSink(name string, message func(artifact BrowserArtifact) string) *syslogSink {
+	s := &syslogSink{sink: &sink{name: name, options: &SyslogSink, eventLines: 1}}
+	s.encode = func(artifact BrowserArtifact) ([]byte, error) {
+		return []byte(message(artifact) + "\n"), nil
+	}
+	s.connect = s.parseURL
+	s.disconnect = s.close
+	s.deliver = s.send
+	return s
+}
+
+// parseURL reads the -syslog_url, e.g. udp://collector:514, the connection is opened by the first message
+func (s *syslogSink) parseURL() error {
+	if s.options.URL == "" {
+		return fmt.Errorf("no URL given to the %s output", s.name)
+	}
+	parsed, err := url.Parse(s.options.URL)
+	if err != nil {
+		return err
+	}
+
+	port := map[string]string{"udp": "514", "tcp": "514", "tls": "6514"}
+	if _, ok := port[parsed.Scheme]; !ok {
+		return fmt.Errorf("syslog URL must start with udp://, tcp:// or tls://: %s", s.options.URL)
+	}
+	if SyslogFraming != "octet" && SyslogFraming != "newline" {
+		return fmt.Errorf("unknown syslog framing: %s", SyslogFraming)
+	}
+	s.network = parsed.Scheme
+	s.address = parsed.Host
+	if parsed.Port() == "" {
+		s.address = net.JoinHostPort(parsed.Hostname(), port[parsed.Scheme])
+	}
+	return nil
+}
+
+func (s *syslogSink) dial() error {
+	dialer := &net.Dialer{Timeout: s.options.Timeout}
+	if s.network != "tls" {
+		conn, err := dialer.Dial(s.network, s.address)
+		if err != nil {
+			return err
+		}
+		s.watch(conn)
+		return nil
+	}
+
+	config, err := TLSConfig(SinkTLS)
+	if err != nil {
+		return permanentError{err}
+	}
+	if config.ServerName == "" {
+		config.ServerName, _, _ = net.SplitHostPort(s.address)
+	}
+	conn, err := tls.DialWithDialer(dialer, "tcp", s.address, config)
+	if err != nil {
+		return err
+	}
+	s.watch(conn)
+	return nil
+}
+
+// watch reads the connection until the collector closes it. Syslog has no acknowledgment, messages written to a
+// connection the collector closed are lost: the close is noticed before the next message instead of by a write error.
+func (s *syslogSink) watch(conn net.Conn) {
+	s.conn = conn
+	closed := make(chan struct{})
+	s.closed = closed
+	if s.network == "udp" {
+		return
+	}
+	go func() {
+		buffer := make([]byte, 512)
+		for {
+			if _, err := conn.Read(buffer); err != nil {
+				close(closed)
+				return
+			}
+		}
+	}()
+}
+
+func (s *syslogSink) close() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// send writes the messages, returning those not written when the connection fails
+func (s *syslogSink) send(events [][]byte) ([][]byte, error) {
+	for i, event := range events {
+		if SyslogRate > 0 {
+			now := time.Now()
+			if s.next.After(now) {
+				time.Sleep(s.next.Sub(now))
+			} else {
+				s.next = now
+			}
+			s.next = s.next.Add(time.Second / time.Duration(SyslogRate))
+		}
+
+		select {
+		case <-s.closed:
+			s.close()
+		default:
+		}
+		if s.conn == nil {
+			if err := s.dial(); err != nil {
+				return events[i:], err
+			}
+		}
+
+		message := strings.TrimSuffix(string(event), "\n")
+		switch {
+		case s.network == "udp":
+		case SyslogFraming == "octet":
+			message = fmt.Sprintf("%d %s", len(message), message)
+		default:
+			message += "\n"
+		}
+
+		s.conn.SetWriteDeadline(time.Now().Add(s.options.Timeout))
+		if _, err := s.conn.Write([]byte(message)); err != nil {
+			s.close()
+			return events[i:], err
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,313 @@
+package export
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	. "local/BrowserArtifact/src"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readFrames splits a TCP stream into messages, with octet counting or newline framing
+func readFrames(t *testing.T, reader *bufio.Reader, framing string) []string {
+	var messages []string
+	for {
+		if framing == "newline" {
+			line, err := reader.ReadString('\n')
+			if err == io.EOF && line == "" {
+				return messages
+			}
+			if err != nil {
+				t.Errorf("reading frame: %v", err)
+				return messages
+			}
+			messages = append(messages, strings.TrimSuffix(line, "\n"))
+			continue
+		}
+
+		length, err := reader.ReadString(' ')
+		if err == io.EOF && length == "" {
+			return messages
+		}
+		if err != nil {
+			t.Errorf("reading frame length: %v", err)
+			return messages
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+		if err != nil {
+			t.Errorf("invalid frame length %q", length)
+			return messages
+		}
+		message := make([]byte, n)
+		if _, err := io.ReadFull(reader, message); err != nil {
+			t.Errorf("reading frame: %v", err)
+			return messages
+		}
+		messages = append(messages, string(message))
+	}
+}
+
+// serveFrames accepts one connection and returns the messages read from it once it is closed
+func serveFrames(t *testing.T, listener net.Listener, framing string) <-chan []string {
+	result := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			t.Errorf("accept: %v", err)
+			result <- nil
+			return
+		}
+		defer conn.Close()
+		result <- readFrames(t, bufio.NewReader(conn), framing)
+	}()
+	return result
+}
+
+func newTestSyslogSink(t *testing.T, url string, framing string) *syslogSink {
+	previous := SyslogFraming
+	SyslogFraming = framing
+	t.Cleanup(func() { SyslogFraming = previous })
+
+	s := newSyslogSink("syslog", syslogStructured)
+	s.options = testSinkOptions(url)
+	return s
+}
+
+func writeSyslog(t *testing.T, s *syslogSink) {
+	t.Helper()
+	if err := s.Begin(filepath.Join(t.TempDir(), "spool")); err != nil {
+		t.Fatal(err)
+	}
+	for _, artifact := range testArtifacts() {
+		if err := s.Write(artifact); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.End(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkMessages(t *testing.T, messages []string) {
+	t.Helper()
+	if len(messages) != 3 {
+		t.Fatalf("got %d messages, expected 3: %q", len(messages), messages)
+	}
+	for i, artifactType := range []string{"chrome_history", "download", "cookie"} {
+		if !strings.HasPrefix(messages[i], "<14>1 ") || !strings.Contains(messages[i], " BrowserArtifact ") ||
+			!strings.Contains(messages[i], "[artifact@32473 ") || !strings.Contains(messages[i], " "+artifactType+" ") {
+			t.Errorf("message %d is not a %s syslog message: %s", i, artifactType, messages[i])
+		}
+		if strings.Contains(messages[i], "\n") {
+			t.Errorf("message %d holds a line break: %q", i, messages[i])
+		}
+	}
+}
+
+func TestSyslogUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	writeSyslog(t, newTestSyslogSink(t, "udp://"+conn.LocalAddr().String(), "octet"))
+
+	// One message per datagram, without framing
+	var messages []string
+	buffer := make([]byte, 65536)
+	for len(messages) < 3 {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, string(buffer[:n]))
+	}
+	checkMessages(t, messages)
+}
+
+func TestSyslogTCPFraming(t *testing.T) {
+	for _, framing := range []string{"octet", "newline"} {
+		t.Run(framing, func(t *testing.T) {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer listener.Close()
+			result := serveFrames(t, listener, framing)
+
+			writeSyslog(t, newTestSyslogSink(t, "tcp://"+listener.Addr().String(), framing))
+			checkMessages(t, <-result)
+		})
+	}
+}
+
+// writeTestCertificate writes a self-signed certificate for 127.0.0.1, returning the path of the PEM file
+func writeTestCertificate(t *testing.T) (tls.Certificate, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "collector"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	certificate, err := tls.X509KeyPair(certPEM, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(path, certPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return certificate, path
+}
+
+func TestSyslogTLS(t *testing.T) {
+	certificate, caFile := writeTestCertificate(t)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{certificate}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	result := serveFrames(t, listener, "octet")
+
+	previous := SinkTLS
+	SinkTLS = TLSOptions{CAFile: caFile}
+	defer func() { SinkTLS = previous }()
+
+	writeSyslog(t, newTestSyslogSink(t, "tls://"+listener.Addr().String(), "octet"))
+	checkMessages(t, <-result)
+}
+
+func TestSyslogReconnect(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// The collector closes the first connection after one message
+	first := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			first <- ""
+			return
+		}
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		conn.Close()
+		first <- line
+	}()
+
+	s := newTestSyslogSink(t, "tcp://"+listener.Addr().String(), "newline")
+	s.options.BatchSize = 1
+	if err := s.Begin(filepath.Join(t.TempDir(), "spool")); err != nil {
+		t.Fatal(err)
+	}
+	artifacts := testArtifacts()
+	if err := s.Write(artifacts[0]); err != nil {
+		t.Fatal(err)
+	}
+	if line := <-first; !strings.Contains(line, "chrome_history") {
+		t.Fatalf("first connection got %q", line)
+	}
+	select {
+	case <-s.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("close of the connection not noticed")
+	}
+
+	// The next messages go to a new connection
+	result := serveFrames(t, listener, "newline")
+	for _, artifact := range artifacts[1:] {
+		if err := s.Write(artifact); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.End(); err != nil {
+		t.Fatal(err)
+	}
+	messages := <-result
+	if len(messages) != 2 || !strings.Contains(messages[0], " download ") || !strings.Contains(messages[1], " cookie ") {
+		t.Errorf("second connection got %q", messages)
+	}
+	if s.sent != 3 || s.spooled != 0 {
+		t.Errorf("sent %d spooled %d, expected 3 and 0", s.sent, s.spooled)
+	}
+}
+
+func TestSyslogEscaping(t *testing.T) {
+	artifact := BrowserArtifact{
+		ArtifactType:  "odd|type",
+		Url:           "https://example.com/?a=b\\c",
+		Title:         "line\nbreak\ttab",
+		TimestampType: "visit_date",
+	}
+	artifact.SetTimestamp(1700000000000000, EpochUnixMicroseconds)
+
+	cef := syslogCEF(artifact)
+	for _, expected := range []string{
+		`CEF:0|BrowserArtifact|BrowserArtifact|` + Version + `|odd\|type|odd\|type visit_date|1|`,
+		`request=https://example.com/?a\=b\\c`,
+		`title=line\nbreak` + "\t" + `tab`,
+		`rt=1700000000000`,
+	} {
+		if !strings.Contains(cef, expected) {
+			t.Errorf("CEF message without %q: %s", expected, cef)
+		}
+	}
+
+	leef := syslogLEEF(artifact)
+	for _, expected := range []string{
+		`LEEF:1.0|BrowserArtifact|BrowserArtifact|` + Version + `|odd\|type|`,
+		"\turl=https://example.com/?a=b\\c\t",
+		"\ttitle=line break tab",
+		"devTimeFormat=MMM dd yyyy HH:mm:ss.SSS z\tdevTime=Nov 14 2023 22:13:20.000 UTC",
+	} {
+		if !strings.Contains(leef, expected) {
+			t.Errorf("LEEF message without %q: %q", expected, leef)
+		}
+	}
+
+	structured := syslogStructured(BrowserArtifact{ArtifactType: "visit", Title: `a "quoted" ] \ value` + "\n"})
+	if expected := `title="a \"quoted\" \] \\ value "`; !strings.Contains(structured, expected) {
+		t.Errorf("structured data without %q: %s", expected, structured)
+	}
+	for _, message := range []string{cef, leef, structured} {
+		if strings.ContainsAny(message, "\r\n") {
+			t.Errorf("message holds a line break: %q", message)
+		}
+	}
+}
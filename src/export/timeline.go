@@ -0,0 +1,253 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	. "local/BrowserArtifact/src"
+	"os"
+	"strings"
+)
+
+/**
+ * Timeline formats of the forensic suites, to merge the artifacts with filesystem and event log timelines:
+ * bodyfile read by mactime, TLN and the log2timeline CSV (l2t_csv).
+ * Artifacts without a time of their own (not set, or the time of collection) have no place in a timeline and are
+ * skipped.
+ */
+
+func init() {
+	RegisterFormat(Format{Name: "bodyfile", Extension: ".body", Description: "Sleuth Kit bodyfile for mactime", New: func() Exporter { return &BodyfileExporter{} }})
+	RegisterFormat(Format{Name: "tln", Extension: ".tln", Description: "TLN timeline (time|source|host|user|description)", New: func() Exporter { return &TLNExporter{} }})
+	RegisterFormat(Format{Name: "l2t_csv", Extension: ".l2t.csv", Description: "log2timeline CSV", New: func() Exporter { return &L2TCSVExporter{} }})
+}
+
+// inTimeline tells if the artifact has a time of its own
+func inTimeline(artifact BrowserArtifact) bool {
+	return !artifact.Time.IsZero() && artifact.TimestampEpoch != EpochCollection
+}
+
+// macb returns the MACB letter of the timestamp type: Modified, Accessed, Changed or Born, empty when unknown
+func macb(timestampType string) string {
+	timestampType = strings.ToLower(timestampType)
+	contains := func(words ...string) bool {
+		for _, word := range words {
+			if strings.Contains(timestampType, word) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case contains("creat", "added", "firstused", "install"):
+		return "B"
+	case contains("modif", "lastmod", "update", "changed"):
+		return "M"
+	case contains("access", "visit", "used", "navigation", "request", "fetch", "active", "response", "closed"):
+		return "A"
+	}
+	return ""
+}
+
+// timelineShort is the main value of the artifact
+func timelineShort(artifact BrowserArtifact) string {
+	for _, value := range []string{artifact.Url, artifact.Filename, artifact.AddonName, artifact.Title, artifact.Value} {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// timelineDescription describes the artifact on one line
+func timelineDescription(artifact BrowserArtifact) string {
+	description := fmt.Sprintf("[%s %s %s]", artifact.App, artifact.ArtifactType, artifact.TimestampType)
+	for _, value := range []string{timelineShort(artifact), artifact.Title, artifact.Filename, artifact.Cookie, artifact.Fieldname} {
+		if value != "" && !strings.Contains(description, value) {
+			description += " " + value
+		}
+	}
+	if artifact.Recovery != "" {
+		description += " (recovered: " + artifact.Recovery + ")"
+	}
+	return strings.Join(strings.Fields(description), " ")
+}
+
+// escapePipes escapes the separator of the pipe delimited formats
+func escapePipes(value string) string {
+	return strings.ReplaceAll(value, "|", "%7C")
+}
+
+// BodyfileExporter writes the Sleuth Kit 3.x bodyfile: MD5|name|inode|mode|UID|GID|size|atime|mtime|ctime|crtime
+type BodyfileExporter struct {
+	file   *os.File
+	writer *bufio.Writer
+}
+
+func (w *BodyfileExporter) Begin(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	w.file = file
+	w.writer = bufio.NewWriter(file)
+	return nil
+}
+
+func (w *BodyfileExporter) Write(artifact BrowserArtifact) error {
+	if !inTimeline(artifact) {
+		return nil
+	}
+
+	// Unknown timestamp types are reported as modification times
+	var atime, mtime, ctime, crtime int64
+	seconds := artifact.Time.Unix()
+	switch macb(artifact.TimestampType) {
+	case "A":
+		atime = seconds
+	case "C":
+		ctime = seconds
+	case "B":
+		crtime = seconds
+	default:
+		mtime = seconds
+	}
+
+	name := timelineDescription(artifact)
+	if artifact.User != "" {
+		name += " (" + artifact.User + ")"
+	}
+	size := artifact.BytesIn + artifact.BytesOut
+	_, err := fmt.Fprintf(w.writer, "0|%s|0|0|0|0|%d|%d|%d|%d|%d\n", escapePipes(name), size, atime, mtime, ctime, crtime)
+	return err
+}
+
+func (w *BodyfileExporter) End() error {
+	if err := w.writer.Flush(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+// TLNExporter writes the TLN format: Time|Source|Host|User|Description
+type TLNExporter struct {
+	file   *os.File
+	writer *bufio.Writer
+}
+
+func (w *TLNExporter) Begin(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	w.file = file
+	w.writer = bufio.NewWriter(file)
+	return nil
+}
+
+func (w *TLNExporter) Write(artifact BrowserArtifact) error {
+	if !inTimeline(artifact) {
+		return nil
+	}
+
+	// The host of the evidence is not known, the field is left empty
+	_, err := fmt.Fprintf(w.writer, "%d|%s|%s|%s|%s\n", artifact.Time.Unix(), strings.ToUpper(artifact.App), "",
+		escapePipes(artifact.User), escapePipes(timelineDescription(artifact)))
+	return err
+}
+
+func (w *TLNExporter) End() error {
+	if err := w.writer.Flush(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+var l2tHeader = []string{
+	"date", "time", "timezone", "MACB", "source", "sourcetype", "type", "user", "host", "short", "desc", "version",
+	"filename", "inode", "notes", "format", "extra",
+}
+
+// L2TCSVExporter writes the log2timeline CSV format, times in UTC
+type L2TCSVExporter struct {
+	file   *os.File
+	writer *csv.Writer
+}
+
+func (w *L2TCSVExporter) Begin(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	w.file = file
+	w.writer = csv.NewWriter(file)
+	return w.writer.Write(l2tHeader)
+}
+
+func (w *L2TCSVExporter) Write(artifact BrowserArtifact) error {
+	if !inTimeline(artifact) {
+		return nil
+	}
+
+	flags := []byte("....")
+	if letter := macb(artifact.TimestampType); letter != "" {
+		flags[strings.Index("MACB", letter)] = letter[0]
+	}
+
+	var extra []string
+	for _, field := range [][2]string{
+		{"browser_profile", artifact.BrowserProfile},
+		{"browser_profile_name", artifact.BrowserProfileName},
+		{"browser_profile_default", fmt.Sprint(artifact.BrowserProfileDefault)},
+		{"browser_install", artifact.BrowserInstall},
+		{"timestamp_raw", fmt.Sprint(artifact.TimestampRaw)},
+		{"timestamp_epoch", artifact.TimestampEpoch},
+		{"recovery", artifact.Recovery},
+		{"confidence", artifact.Confidence},
+	} {
+		if field[1] != "" && field[1] != "false" {
+			extra = append(extra, field[0]+": "+field[1])
+		}
+	}
+
+	dash := func(value string) string {
+		if value == "" {
+			return "-"
+		}
+		return value
+	}
+	return w.writer.Write([]string{
+		artifact.Time.UTC().Format("01/02/2006"),
+		artifact.Time.UTC().Format("15:04:05"),
+		"UTC",
+		string(flags),
+		"WEBHIST",
+		dash(strings.TrimSpace(artifact.App + " " + artifact.ArtifactType)),
+		dash(artifact.TimestampType),
+		dash(artifact.User),
+		"-",
+		dash(timelineShort(artifact)),
+		timelineDescription(artifact),
+		"2",
+		"-",
+		"-",
+		dash(artifact.TimestampWarning),
+		"BrowserArtifact",
+		dash(strings.Join(extra, "; ")),
+	})
+}
+
+func (w *L2TCSVExporter) End() error {
+	w.writer.Flush()
+	if err := w.writer.Error(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
@@ -0,0 +1,167 @@
+package src
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+/**
+ * Registry of the browsers and artifact extractors.
+ * Browser packages register themselves from init(): a browser gives the family it belongs to and how to find its
+ * profiles, an extractor gives the files it reads in a profile of a family and how to parse them.
+ * Adding an artifact is a matter of adding a file calling RegisterExtractor.
+ */
+
+// Profile is a browser profile directory of a user of the target system
+type Profile struct {
+	User      string // User of the target system
+	Browser   string // chrome, edge, firefox...
+	Family    string // chromium, firefox
+	Path      string // Profile directory
+	CachePath string // Directory holding the disk cache
+	Directory string // Name of the profile directory, e.g. Default
+	Name      string // Name displayed by the browser
+	Account   string // Account signed in the profile
+	Default   bool   // Default profile of the browser or of an install
+	Install   string // Install the profile is the default of (Firefox install hash)
+}
+
+type Extractor interface {
+	Name() string                     // Unique name, e.g. chromium_history
+	Browser() string                  // Browser family, e.g. chromium
+	ArtifactType() string             // Artifact types produced
+	Locate(profile Profile) []string  // Paths to read in a profile
+	Extract(path string, emit Emit)   // Parse a path returned by Locate
+	Sources(profile Profile) []string // Files and directories read in a profile, copied by collect
+}
+
+type Browser struct {
+	Name         string
+	Family       string
+	FindProfiles func(user string, browser string, osName string) []Profile
+	Files        func(user string, browser string, osName string) []string // Files listing the profiles, copied by collect
+}
+
+var browsers []Browser
+var extractors []Extractor
+
+func RegisterBrowser(browser Browser) {
+	browsers = append(browsers, browser)
+}
+
+func RegisterExtractor(extractor Extractor) {
+	for _, registered := range extractors {
+		if registered.Name() == extractor.Name() {
+			panic("extractor registered twice: " + extractor.Name())
+		}
+	}
+	extractors = append(extractors, extractor)
+}
+
+// Browsers returns the registered browsers sorted by name
+func Browsers() []Browser {
+	sorted := append([]Browser{}, browsers...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
+
+func GetBrowser(name string) (Browser, bool) {
+	for _, browser := range browsers {
+		if browser.Name == name {
+			return browser, true
+		}
+	}
+	return Browser{}, false
+}
+
+// Extractors returns the extractors of a browser family, all of them when family is empty
+func Extractors(family string) []Extractor {
+	var output []Extractor
+	for _, extractor := range extractors {
+		if family == "" || extractor.Browser() == family {
+			output = append(output, extractor)
+		}
+	}
+	return output
+}
+
+// RunExtractor extracts the artifacts of a profile and emits them tagged with it
+func RunExtractor(extractor Extractor, profile Profile, emit Emit) {
+	tag := func(artifact BrowserArtifact) {
+		artifact.User = profile.User
+		artifact.App = profile.Browser
+		artifact.BrowserProfile = profile.Directory
+		artifact.BrowserProfileName = profile.Name
+		artifact.BrowserAccount = profile.Account
+		artifact.BrowserProfileDefault = profile.Default
+		artifact.BrowserInstall = profile.Install
+		if artifact.UrlDomain == "" {
+			artifact.UrlDomain = urlDomain(artifact.Url)
+		}
+		emit(artifact)
+	}
+	for _, path := range extractor.Locate(profile) {
+		extractor.Extract(path, tag)
+	}
+}
+
+// urlDomain returns the host of a URL, cookies hold a host instead of a URL
+func urlDomain(rawURL string) string {
+	if rawURL == "" {
+		return ""
+	}
+	if parsed, err := url.Parse(rawURL); err == nil && parsed.Host != "" {
+		return parsed.Hostname()
+	}
+	if !strings.ContainsAny(rawURL, "/:") {
+		return strings.TrimPrefix(rawURL, ".")
+	}
+	return ""
+}
+
+// FileExtractor is an Extractor reading files at fixed places of a profile
+type FileExtractor struct {
+	ExtractorName string
+	Family        string
+	Types         string
+	LocateFunc    func(profile Profile) []string
+	ExtractFunc   func(path string) []BrowserArtifact
+	StreamFunc    func(path string, emit Emit)   // Instead of ExtractFunc, for files with many records
+	SourcesFunc   func(profile Profile) []string // When Locate gives a directory only part of which is read
+}
+
+func (e FileExtractor) Name() string {
+	return e.ExtractorName
+}
+
+func (e FileExtractor) Browser() string {
+	return e.Family
+}
+
+func (e FileExtractor) ArtifactType() string {
+	return e.Types
+}
+
+func (e FileExtractor) Locate(profile Profile) []string {
+	return e.LocateFunc(profile)
+}
+
+func (e FileExtractor) Extract(path string, emit Emit) {
+	if e.StreamFunc != nil {
+		e.StreamFunc(path, emit)
+		return
+	}
+	for _, artifact := range e.ExtractFunc(path) {
+		emit(artifact)
+	}
+}
+
+func (e FileExtractor) Sources(profile Profile) []string {
+	if e.SourcesFunc != nil {
+		return e.SourcesFunc(profile)
+	}
+	return e.LocateFunc(profile)
+}
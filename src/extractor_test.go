@@ -0,0 +1,31 @@
+package src
+
+import "testing"
+
+func TestRunExtractorDomain(t *testing.T) {
+	urls := map[string]string{
+		"https://www.example.com:8443/path?q=1": "www.example.com",
+		".example.org":                          "example.org",
+		"file:///C:/Users/alice/report.pdf":     "",
+		"":                                      "",
+	}
+	extract := func(emit Emit) {
+		for rawURL := range urls {
+			emit(BrowserArtifact{Url: rawURL})
+		}
+		emit(BrowserArtifact{Url: "https://cdn.example.net/", UrlDomain: "example.net"})
+	}
+
+	got := map[string]string{}
+	RunExtractor(testExtractor{name: "domains", extract: extract}, Profile{}, func(artifact BrowserArtifact) {
+		got[artifact.Url] = artifact.UrlDomain
+	})
+	for rawURL, domain := range urls {
+		if got[rawURL] != domain {
+			t.Errorf("domain of %q is %q, expected %q", rawURL, got[rawURL], domain)
+		}
+	}
+	if got["https://cdn.example.net/"] != "example.net" {
+		t.Errorf("domain set by the extractor replaced by %q", got["https://cdn.example.net/"])
+	}
+}
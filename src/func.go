@@ -3,12 +3,12 @@ package src
 import (
 	"fmt"
 	"io"
-	"os"
+	"sync"
 	"time"
 )
 
 func CheckPath(path string, isDir bool) bool {
-	if file, err := os.Stat(path); err == nil {
+	if file, err := TargetStat(path); err == nil {
 		if isDir {
 			return file.IsDir()
 		} else {
@@ -26,21 +26,29 @@ func CheckPath(path string, isDir bool) bool {
 
 var Log = NewLogger()
 
+// Logger is safe to use from several goroutines
 type Logger struct {
+	mutex  sync.Mutex
 	writer io.Writer
 	level  string // debug, info, warn, error
 }
 
 func (l *Logger) SetOutput(w io.Writer) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
 	l.writer = w
 }
 
 func (l *Logger) SetLevel(level string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
 	l.level = level
 }
 
 func (l *Logger) Log(level string, pkg string, source string, msg string) {
 	log := fmt.Sprintf("time=%s level=%s package=%s source=%s msg=%s\n", time.Now().Format(time.RFC3339), level, pkg, source, msg)
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
 	if level == "debug" && l.level != "debug" {
 		return
 	} else if level == "info" && !(l.level == "info" || l.level == "debug") {
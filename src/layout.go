@@ -0,0 +1,443 @@
+package src
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+/**
+ * Layouts of the evidence given to -root, detected by SetTarget:
+ * - a directory holding the filesystem of the target: a mounted image, or a triage folder such as the KAPE output,
+ *   where the files of a volume are under <destination>/C/
+ * - a Velociraptor collection, zipped or extracted: files are under uploads/<accessor>/<device>/ and names are
+ *   URL-encoded, e.g. uploads/auto/C%3A/Users or uploads/ntfs/%5C%5C.%5CC%3A/Users
+ * - a zip of any of these, such as a zip made by collect
+ * The root of the target system is the first directory holding Users or home, looked for in the first levels of the
+ * tree. Zips and Velociraptor collections are indexed in memory and read through an fs.FS, names of files in a zip are
+ * matched without case as on Windows.
+ */
+
+// Levels of the tree searched for the root of the target system
+const layoutDepth = 4
+
+var driveLetter = regexp.MustCompile(`^[A-Za-z]:?$`)
+
+type layout struct {
+	kind   string // directory, zip, Velociraptor collection...
+	source string // Path given to -root
+	prefix string // Root of the target system in the tree
+	root   string // RootPath
+	fsys   fs.FS  // TargetFS
+	os     string // Target OS guessed from the tree, empty when unknown
+}
+
+func (l layout) describe() string {
+	description := l.kind + " " + l.source
+	if l.prefix != "." {
+		description += ", system root " + l.prefix
+	}
+	if l.os != "" {
+		description += ", " + l.os + " system"
+	}
+	return description
+}
+
+func detectLayout(root string) (layout, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return layout{}, err
+	}
+
+	l := layout{source: root, root: root}
+	var tree fs.FS
+	if info.IsDir() {
+		if isVelociraptor(os.DirFS(root)) {
+			l.kind = "Velociraptor collection"
+			tree, err = indexDirectory(root)
+			if err != nil {
+				return layout{}, err
+			}
+		} else {
+			l.kind = "directory"
+			tree = os.DirFS(root)
+		}
+	} else {
+		// The zip stays open until the end of the run
+		reader, err := zip.OpenReader(root)
+		if err != nil {
+			return layout{}, fmt.Errorf("%s is neither a directory nor a zip: %w", root, err)
+		}
+		l.kind = "zip"
+		index := indexZip(&reader.Reader, false)
+		if isVelociraptor(index) {
+			l.kind = "Velociraptor collection zip"
+			index = indexZip(&reader.Reader, true)
+		}
+		tree = index
+	}
+
+	prefix, found := findSystemRoot(tree)
+	if !found {
+		if !info.IsDir() {
+			return layout{}, fmt.Errorf("no Users or home directory found in %s", root)
+		}
+		Log.Log("warn", "src", "target", "No Users or home directory found in "+root)
+		prefix = "."
+	}
+	l.prefix = prefix
+	l.os = guessOS(tree, prefix)
+
+	switch {
+	case l.kind == "directory":
+		// Read from the host filesystem, from the root of the system
+		l.root = filepath.Join(root, filepath.FromSlash(prefix))
+	case prefix == ".":
+		l.fsys = tree
+	default:
+		l.fsys, err = fs.Sub(tree, prefix)
+		if err != nil {
+			return layout{}, err
+		}
+	}
+	return l, nil
+}
+
+// isVelociraptor tells if a tree is a Velociraptor collection: an uploads directory next to its metadata
+func isVelociraptor(tree fs.FS) bool {
+	if info, err := fs.Stat(tree, "uploads"); err != nil || !info.IsDir() {
+		return false
+	}
+	for _, name := range []string{"uploads.json", "collection_context.json", "client_info.json", "log.json"} {
+		if _, err := fs.Stat(tree, name); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// findSystemRoot returns the shallowest directory holding Users or home
+func findSystemRoot(tree fs.FS) (string, bool) {
+	directories := []string{"."}
+	for depth := 0; depth <= layoutDepth && len(directories) > 0; depth++ {
+		var next []string
+		for _, directory := range directories {
+			entries, err := fs.ReadDir(tree, directory)
+			if err != nil {
+				continue
+			}
+			for _, entry := range entries {
+				name := strings.ToLower(entry.Name())
+				if entry.IsDir() && (name == "users" || name == "home") {
+					return directory, true
+				}
+			}
+			for _, entry := range entries {
+				if entry.IsDir() {
+					next = append(next, path.Join(directory, entry.Name()))
+				}
+			}
+		}
+		directories = next
+	}
+	return "", false
+}
+
+// guessOS guesses the OS from the directories of the system root and of the user homes
+func guessOS(tree fs.FS, root string) string {
+	names := func(directory string) map[string]bool {
+		found := map[string]bool{}
+		entries, _ := fs.ReadDir(tree, directory)
+		for _, entry := range entries {
+			found[strings.ToLower(entry.Name())] = true
+		}
+		return found
+	}
+
+	top := names(root)
+	switch {
+	case top["windows"] || top["program files"] || top["programdata"]:
+		return "windows"
+	case top["applications"] || top["library"]:
+		return "darwin"
+	case top["home"] && !top["users"]:
+		return "linux"
+	}
+
+	// Users of Windows and macOS, told apart by their homes
+	entries, _ := fs.ReadDir(tree, path.Join(root, "Users"))
+	for _, entry := range entries {
+		home := names(path.Join(root, "Users", entry.Name()))
+		if home["appdata"] {
+			return "windows"
+		}
+		if home["library"] {
+			return "darwin"
+		}
+	}
+	if driveLetter.MatchString(path.Base(root)) {
+		return "windows"
+	}
+	return ""
+}
+
+// indexName cleans the name of a file in a zip, decoding the names of Velociraptor, empty when it is not valid
+func indexName(name string, decode bool) string {
+	var elements []string
+	for _, element := range strings.Split(strings.ReplaceAll(name, "\\", "/"), "/") {
+		if element == "" || element == "." {
+			continue
+		}
+		if element == ".." {
+			return ""
+		}
+		if decode {
+			if decoded, err := url.PathUnescape(element); err == nil && decoded != "" {
+				element = decoded
+			}
+		}
+		elements = append(elements, element)
+	}
+	return strings.Join(elements, "/")
+}
+
+func indexZip(reader *zip.Reader, decode bool) *indexFS {
+	index := newIndexFS()
+	for _, file := range reader.File {
+		name := indexName(file.Name, decode)
+		if name == "" {
+			continue
+		}
+		info := file.FileInfo()
+		if info.IsDir() {
+			index.add(name, info, nil)
+			continue
+		}
+		file, named := file, namedInfo{FileInfo: info, name: path.Base(name)}
+		index.add(name, info, func() (fs.File, error) {
+			reader, err := file.Open()
+			if err != nil {
+				return nil, err
+			}
+			return &zipFile{ReadCloser: reader, info: named}, nil
+		})
+	}
+	return index
+}
+
+// indexDirectory indexes an extracted Velociraptor collection, names are decoded
+func indexDirectory(root string) (*indexFS, error) {
+	index := newIndexFS()
+	err := filepath.WalkDir(root, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			Log.Log("warn", "src", "target", "Error reading "+file+": "+err.Error())
+			return nil
+		}
+		relative, err := filepath.Rel(root, file)
+		if err != nil || relative == "." {
+			return err
+		}
+		name := indexName(filepath.ToSlash(relative), true)
+		if name == "" {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		if entry.IsDir() {
+			index.add(name, info, nil)
+			return nil
+		}
+		index.add(name, info, func() (fs.File, error) {
+			return os.Open(file)
+		})
+		return nil
+	})
+	return index, err
+}
+
+// indexFS is a tree of files listed in memory: files of a zip or of a collection whose names are decoded
+type indexFS struct {
+	entries map[string]*indexEntry
+	folded  map[string]string // Names in lower case
+}
+
+type indexEntry struct {
+	info     fs.FileInfo
+	open     func() (fs.File, error) // nil for directories
+	children map[string]bool
+}
+
+func newIndexFS() *indexFS {
+	index := &indexFS{entries: map[string]*indexEntry{}, folded: map[string]string{}}
+	index.entries["."] = &indexEntry{info: indexInfo{name: "."}, children: map[string]bool{}}
+	return index
+}
+
+// add adds a file, or a directory when open is nil, and the directories above it
+func (f *indexFS) add(name string, info fs.FileInfo, open func() (fs.File, error)) {
+	base := path.Base(name)
+	if open == nil {
+		info = indexInfo{name: base, modified: info.ModTime()}
+	} else {
+		info = namedInfo{FileInfo: info, name: base}
+	}
+
+	if entry, ok := f.entries[name]; ok {
+		// A directory seen in the path of a file before its own entry
+		if open == nil {
+			entry.info = info
+		}
+		return
+	}
+	entry := &indexEntry{info: info, open: open}
+	if open == nil {
+		entry.children = map[string]bool{}
+	}
+	f.entries[name] = entry
+	f.folded[strings.ToLower(name)] = name
+
+	parent := path.Dir(name)
+	if _, ok := f.entries[parent]; !ok {
+		f.add(parent, indexInfo{name: path.Base(parent)}, nil)
+	}
+	if children := f.entries[parent].children; children != nil {
+		children[base] = true
+	}
+}
+
+// lookup returns the entry of a name and its name in the index
+func (f *indexFS) lookup(op string, name string) (string, *indexEntry, error) {
+	if !fs.ValidPath(name) {
+		return "", nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if entry, ok := f.entries[name]; ok {
+		return name, entry, nil
+	}
+	if folded, ok := f.folded[strings.ToLower(name)]; ok {
+		return folded, f.entries[folded], nil
+	}
+	return "", nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
+
+func (f *indexFS) Open(name string) (fs.File, error) {
+	_, entry, err := f.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if entry.open == nil {
+		entries, err := f.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		return &indexDirectoryFile{info: entry.info, entries: entries}, nil
+	}
+	return entry.open()
+}
+
+func (f *indexFS) Stat(name string) (fs.FileInfo, error) {
+	_, entry, err := f.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return entry.info, nil
+}
+
+func (f *indexFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	name, entry, err := f.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if entry.children == nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	var names []string
+	for child := range entry.children {
+		names = append(names, child)
+	}
+	sort.Strings(names)
+	var entries []fs.DirEntry
+	for _, child := range names {
+		childName := child
+		if name != "." {
+			childName = name + "/" + child
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(f.entries[childName].info))
+	}
+	return entries, nil
+}
+
+// indexInfo describes a directory of the index
+type indexInfo struct {
+	name     string
+	modified time.Time
+}
+
+func (i indexInfo) Name() string       { return i.name }
+func (i indexInfo) Size() int64        { return 0 }
+func (i indexInfo) Mode() fs.FileMode  { return fs.ModeDir | 0555 }
+func (i indexInfo) ModTime() time.Time { return i.modified }
+func (i indexInfo) IsDir() bool        { return true }
+func (i indexInfo) Sys() interface{}   { return nil }
+
+// namedInfo describes a file under its decoded name
+type namedInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (i namedInfo) Name() string {
+	return i.name
+}
+
+type zipFile struct {
+	io.ReadCloser
+	info fs.FileInfo
+}
+
+func (f *zipFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+type indexDirectoryFile struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *indexDirectoryFile) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *indexDirectoryFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: fs.ErrInvalid}
+}
+
+func (d *indexDirectoryFile) Close() error {
+	return nil
+}
+
+func (d *indexDirectoryFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	entries := d.entries[d.offset:]
+	if n > 0 {
+		if len(entries) == 0 {
+			return nil, io.EOF
+		}
+		if n < len(entries) {
+			entries = entries[:n]
+		}
+	}
+	d.offset += len(entries)
+	return entries, nil
+}
@@ -0,0 +1,365 @@
+package src
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+/**
+ * Recovery of records from the SQLite write-ahead log and rollback journal.
+ * The main database file is rebuilt as it was at each WAL commit, with each stale frame left by a previous
+ * WAL generation, and before the transaction saved in the journal. The processor query is run on every image,
+ * records the processor did not return are marked as recovered:
+ * - wal: the record only exists in the WAL, it has not been checkpointed into the database yet (immutable mode only,
+ *   a copied database is opened with its WAL)
+ * - wal_superseded: the record was in an older WAL frame, it has since been overwritten or deleted
+ * - journal: the record was in the database before the transaction saved in the rollback journal (immutable mode
+ *   only, SQLite rolls the hot journal of a copied database back)
+ */
+
+var RecoverRecords = true
+
+const (
+	walHeaderSize      = 32
+	walFrameHeaderSize = 24
+	journalMagic       = 0xd9d505f920a163d7
+)
+
+type walFrame struct {
+	page   uint32
+	commit uint32
+	data   []byte
+}
+
+type databaseImage struct {
+	file     *os.File
+	pageSize int
+}
+
+// Reported holds the keys of the records a processor returned, they are not recovered again
+type Reported map[string]bool
+
+func reportedKeys(artifacts []BrowserArtifact) Reported {
+	reported := Reported{}
+	for _, artifact := range artifacts {
+		reported[artifactKey(artifact)] = true
+	}
+	return reported
+}
+
+// TrackReported wraps the emit of a streaming processor to record the keys of the artifacts it emits,
+// nothing is recorded when path has no WAL nor journal to recover records from
+func TrackReported(path string, emit Emit) (Reported, Emit) {
+	reported := Reported{}
+	if !hasLogs(path) {
+		return reported, emit
+	}
+	return reported, func(artifact BrowserArtifact) {
+		reported[artifactKey(artifact)] = true
+		emit(artifact)
+	}
+}
+
+// CollectQuery turns a streaming query into a query returning its artifacts, as RecoverFromLogs runs it
+func CollectQuery(query func(db *Database, emit Emit)) func(db *Database) []BrowserArtifact {
+	return func(db *Database) []BrowserArtifact {
+		artifacts := []BrowserArtifact{}
+		query(db, func(artifact BrowserArtifact) {
+			artifacts = append(artifacts, artifact)
+		})
+		return artifacts
+	}
+}
+
+func hasLogs(path string) bool {
+	return RecoverRecords && (CheckPath(path+"-wal", false) || CheckPath(path+"-journal", false))
+}
+
+// RecoverFromLogs runs query on every database state found in the WAL and journal of path,
+// reported holds the records the processor already returned with the same query
+func RecoverFromLogs(path string, reported []BrowserArtifact, query func(db *Database) []BrowserArtifact) []BrowserArtifact {
+	if !hasLogs(path) {
+		return nil
+	}
+	return RecoverReported(path, reportedKeys(reported), query)
+}
+
+// RecoverReported is RecoverFromLogs for a streaming processor, whose records were recorded by TrackReported
+func RecoverReported(path string, reported Reported, query func(db *Database) []BrowserArtifact) []BrowserArtifact {
+	if !hasLogs(path) {
+		return nil
+	}
+	hasWAL := CheckPath(path+"-wal", false)
+	hasJournal := CheckPath(path+"-journal", false)
+
+	main, err := TargetReadFile(path)
+	if err != nil || len(main) < 100 {
+		return nil
+	}
+	pageSize := int(binary.BigEndian.Uint16(main[16:18]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+
+	workspace, err := os.MkdirTemp("", "BrowserArtifact-")
+	if err != nil {
+		Log.Log("error", "src", "recovery", "Error creating workspace: "+err.Error())
+		return nil
+	}
+	defer os.RemoveAll(workspace)
+
+	image, err := newDatabaseImage(filepath.Join(workspace, "database"), main, pageSize)
+	if err != nil {
+		Log.Log("error", "src", "recovery", "Error creating database image: "+err.Error())
+		return nil
+	}
+	defer image.file.Close()
+
+	// Each state is reduced to the set of records it holds
+	type state struct {
+		recovery  string
+		artifacts []BrowserArtifact
+	}
+	var states []state
+	run := func(recovery string) []BrowserArtifact {
+		artifacts := image.query(query)
+		states = append(states, state{recovery: recovery, artifacts: artifacts})
+		return artifacts
+	}
+
+	current := run("")
+
+	// In copy mode SQLite itself reads the WAL and rolls the hot journal back, the processor already reported those states
+	immutable := SQLiteAccess == "immutable" && TargetFS == nil
+
+	if hasJournal && immutable {
+		journal, err := readJournal(path+"-journal", pageSize)
+		if err != nil {
+			Log.Log("debug", "src", "recovery", "Error reading journal: "+err.Error())
+		} else if len(journal) > 0 {
+			image.apply(journal, 0)
+			run("journal")
+			image.reset(main)
+		}
+	}
+
+	if hasWAL {
+		frames, staleFrames, err := readWAL(path+"-wal", pageSize)
+		if err != nil {
+			Log.Log("debug", "src", "recovery", "Error reading WAL: "+err.Error())
+		}
+
+		// Replay committed transactions one by one, the last one is the current state
+		var pending []walFrame
+		commits := 0
+		for _, frame := range frames {
+			pending = append(pending, frame)
+			if frame.commit == 0 {
+				continue
+			}
+			image.apply(pending, frame.commit)
+			pending = nil
+			commits++
+			current = run("wal_superseded")
+		}
+
+		// Frames of previous WAL generations are laid over the current state, one page at a time
+		for _, frame := range staleFrames {
+			image.apply([]walFrame{frame}, 0)
+			run("wal_superseded")
+			image.apply(latestFrames(frames, frame.page), 0)
+		}
+		Log.Log("debug", "src", "recovery", fmt.Sprintf("Replayed %d commits and %d stale frames of %s", commits, len(staleFrames), path+"-wal"))
+	}
+
+	// Records returned by the processor are not reported again
+	seen := map[string]bool{}
+	for key := range reported {
+		seen[key] = true
+	}
+
+	// Records of the current state missing from the processor results were only in the WAL ignored by immutable mode
+	recovered := []BrowserArtifact{}
+	currentKeys := map[string]bool{}
+	for _, artifact := range current {
+		key := artifactKey(artifact)
+		currentKeys[key] = true
+		if !immutable || seen[key] {
+			continue
+		}
+		seen[key] = true
+		artifact.Recovery = "wal"
+		recovered = append(recovered, artifact)
+	}
+	for _, state := range states {
+		if state.recovery == "" {
+			continue
+		}
+		for _, artifact := range state.artifacts {
+			key := artifactKey(artifact)
+			if currentKeys[key] || seen[key] {
+				continue
+			}
+			seen[key] = true
+			artifact.Recovery = state.recovery
+			recovered = append(recovered, artifact)
+		}
+	}
+
+	if len(recovered) > 0 {
+		Log.Log("info", "src", "recovery", fmt.Sprintf("Recovered %d records from the WAL and journal of %s", len(recovered), path))
+	}
+	return recovered
+}
+
+func artifactKey(artifact BrowserArtifact) string {
+	return fmt.Sprintf("%+v", artifact)
+}
+
+// latestFrames returns the last committed frame of a page, to restore it after a stale frame was laid over it
+func latestFrames(frames []walFrame, page uint32) []walFrame {
+	for i := len(frames) - 1; i >= 0; i-- {
+		if frames[i].page == page {
+			return []walFrame{frames[i]}
+		}
+	}
+	return nil
+}
+
+// readWAL returns the frames of the current WAL generation, and the stale frames left by previous ones
+func readWAL(path string, pageSize int) ([]walFrame, []walFrame, error) {
+	data, err := TargetReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(data) < walHeaderSize {
+		return nil, nil, errors.New("WAL too short")
+	}
+	magic := binary.BigEndian.Uint32(data[0:4])
+	if magic != 0x377f0682 && magic != 0x377f0683 {
+		return nil, nil, errors.New("invalid WAL magic")
+	}
+	if walPageSize := int(binary.BigEndian.Uint32(data[8:12])); walPageSize != 0 {
+		pageSize = walPageSize
+	}
+	salt1 := binary.BigEndian.Uint32(data[16:20])
+	salt2 := binary.BigEndian.Uint32(data[20:24])
+
+	var frames, staleFrames, uncommitted []walFrame
+	valid := true
+	for offset := walHeaderSize; offset+walFrameHeaderSize+pageSize <= len(data); offset += walFrameHeaderSize + pageSize {
+		header := data[offset : offset+walFrameHeaderSize]
+		frame := walFrame{
+			page:   binary.BigEndian.Uint32(header[0:4]),
+			commit: binary.BigEndian.Uint32(header[4:8]),
+			data:   data[offset+walFrameHeaderSize : offset+walFrameHeaderSize+pageSize],
+		}
+		if frame.page == 0 {
+			continue
+		}
+
+		// Once a frame from another generation is found, the following ones are not part of the log anymore
+		if valid && binary.BigEndian.Uint32(header[8:12]) == salt1 && binary.BigEndian.Uint32(header[12:16]) == salt2 {
+			uncommitted = append(uncommitted, frame)
+			if frame.commit != 0 {
+				frames = append(frames, uncommitted...)
+				uncommitted = nil
+			}
+			continue
+		}
+		valid = false
+		staleFrames = append(staleFrames, frame)
+	}
+
+	// Frames of a transaction that never committed are not part of the database either
+	staleFrames = append(uncommitted, staleFrames...)
+	return frames, staleFrames, nil
+}
+
+// readJournal returns the original pages saved in a rollback journal
+func readJournal(path string, pageSize int) ([]walFrame, error) {
+	data, err := TargetReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 28 {
+		return nil, nil
+	}
+
+	// A zeroed header (journal_mode=PERSIST) still leaves the page records behind
+	sectorSize := 512
+	if binary.BigEndian.Uint64(data[0:8]) == journalMagic {
+		if size := int(binary.BigEndian.Uint32(data[20:24])); size >= 512 && size <= 65536 {
+			sectorSize = size
+		}
+		if size := int(binary.BigEndian.Uint32(data[24:28])); size >= 512 && size <= 65536 {
+			pageSize = size
+		}
+	}
+
+	var pages []walFrame
+	for offset := sectorSize; offset+4+pageSize+4 <= len(data); offset += 4 + pageSize + 4 {
+		page := binary.BigEndian.Uint32(data[offset : offset+4])
+		if page == 0 {
+			break
+		}
+		pages = append(pages, walFrame{page: page, data: data[offset+4 : offset+4+pageSize]})
+	}
+	return pages, nil
+}
+
+func newDatabaseImage(path string, main []byte, pageSize int) (*databaseImage, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	image := &databaseImage{file: file, pageSize: pageSize}
+	return image, image.reset(main)
+}
+
+func (i *databaseImage) reset(main []byte) error {
+	err := i.file.Truncate(0)
+	if err != nil {
+		return err
+	}
+	_, err = i.file.WriteAt(main, 0)
+	if err != nil {
+		return err
+	}
+	i.legacyMode()
+	return nil
+}
+
+// apply writes pages into the image, then resizes it to size pages when size is not 0
+func (i *databaseImage) apply(frames []walFrame, size uint32) {
+	for _, frame := range frames {
+		i.file.WriteAt(frame.data, int64(frame.page-1)*int64(i.pageSize))
+		if frame.page == 1 {
+			i.legacyMode()
+		}
+	}
+	if size != 0 {
+		i.file.Truncate(int64(size) * int64(i.pageSize))
+	}
+}
+
+// legacyMode marks the image as a rollback journal database so SQLite does not look for a WAL
+func (i *databaseImage) legacyMode() {
+	i.file.WriteAt([]byte{1, 1}, 18)
+}
+
+func (i *databaseImage) query(query func(db *Database) []BrowserArtifact) []BrowserArtifact {
+	database := &Database{}
+	var err error
+	database.DB, err = openSQLite(sqliteURI(i.file.Name(), "mode=ro"))
+	if err != nil {
+		Log.Log("debug", "src", "recovery", "Error opening database image: "+err.Error())
+		return nil
+	}
+	defer database.DB.Close()
+
+	return query(database)
+}
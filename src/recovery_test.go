@@ -0,0 +1,112 @@
+package src
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func queryValues(db *Database) []BrowserArtifact {
+	rows, err := db.Query("SELECT value FROM records ORDER BY id;")
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	artifacts := []BrowserArtifact{}
+	for rows.Next() {
+		artifact := BrowserArtifact{ArtifactType: "record"}
+		if rows.Scan(&artifact.Url) == nil {
+			artifacts = append(artifacts, artifact)
+		}
+	}
+	return artifacts
+}
+
+// writeWALDatabase writes a database holding a and b, with a WAL that was never checkpointed:
+// c and d are inserted in a first transaction, a is updated to a2 in a second one
+func writeWALDatabase(t *testing.T) string {
+	t.Helper()
+
+	live := filepath.Join(t.TempDir(), "live.sqlite")
+	db, err := sql.Open("sqlite3", live)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	for _, statement := range []string{
+		"PRAGMA journal_mode=WAL;",
+		"PRAGMA wal_autocheckpoint=0;",
+		"CREATE TABLE records (id INTEGER PRIMARY KEY, value TEXT);",
+		"INSERT INTO records (value) VALUES ('a'), ('b');",
+		"PRAGMA wal_checkpoint(TRUNCATE);",
+		"INSERT INTO records (value) VALUES ('c'), ('d');",
+		"UPDATE records SET value = 'a2' WHERE value = 'a';",
+	} {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatal(statement, err)
+		}
+	}
+
+	// The files are copied while the connection is open, closing it would checkpoint the WAL
+	path := filepath.Join(t.TempDir(), "evidence.sqlite")
+	for _, suffix := range []string{"", "-wal"} {
+		data, err := os.ReadFile(live + suffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path+suffix, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+func recoverValues(t *testing.T, path string, access string) map[string][]string {
+	t.Helper()
+
+	previous := SQLiteAccess
+	SQLiteAccess = access
+	defer func() { SQLiteAccess = previous }()
+
+	db, err := OpenDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	artifacts := queryValues(db)
+	artifacts = append(artifacts, RecoverFromLogs(path, artifacts, queryValues)...)
+
+	values := map[string][]string{}
+	for _, artifact := range artifacts {
+		values[artifact.Url] = append(values[artifact.Url], artifact.Recovery)
+	}
+	return values
+}
+
+func TestRecoverFromLogs(t *testing.T) {
+	path := writeWALDatabase(t)
+
+	tests := []struct {
+		access   string
+		expected map[string]string
+	}{
+		{"copy", map[string]string{"a2": "", "b": "", "c": "", "d": "", "a": "wal_superseded"}},
+		{"immutable", map[string]string{"a": "", "b": "", "a2": "wal", "c": "wal", "d": "wal"}},
+	}
+	for _, test := range tests {
+		values := recoverValues(t, path, test.access)
+		if len(values) != len(test.expected) {
+			t.Errorf("%s: got %v, expected %v", test.access, values, test.expected)
+		}
+		for value, recovery := range test.expected {
+			if len(values[value]) != 1 || values[value][0] != recovery {
+				t.Errorf("%s: %s reported as %q, expected once as %q", test.access, value, values[value], recovery)
+			}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package src
+
+import "fmt"
+
+/**
+ * Description of the run producing the artifacts, written by the output formats holding metadata.
+ */
+
+// Version of the tool, set at build time with -ldflags "-X local/BrowserArtifact/src.Version=x.y.z"
+var Version = "dev"
+
+// RunMetadata holds the arguments, host and times of the run, filled by main
+var RunMetadata = map[string]string{}
+
+// RecordEvidenceHashes adds the SHA-256 of every database file read to RunMetadata, as evidence:<path>,
+// and returns the files whose hash changed while they were read
+func RecordEvidenceHashes() []string {
+	type evidence struct {
+		size          int64
+		before, after string
+		changed       bool
+	}
+	files := map[string]*evidence{}
+	var paths []string
+	for _, hash := range EvidenceHashes() {
+		file, ok := files[hash.Path]
+		if !ok {
+			file = &evidence{before: hash.Before}
+			files[hash.Path] = file
+			paths = append(paths, hash.Path)
+		}
+		file.size = hash.Size
+		file.after = hash.After
+		file.changed = file.changed || hash.Before != hash.After || hash.Before != file.before
+	}
+
+	var changed []string
+	for _, path := range paths {
+		file := files[path]
+		if file.changed {
+			changed = append(changed, path)
+			RunMetadata["evidence:"+path] = fmt.Sprintf("size=%d sha256_before=%s sha256_after=%s changed", file.size, file.before, file.after)
+		} else {
+			RunMetadata["evidence:"+path] = fmt.Sprintf("size=%d sha256=%s", file.size, file.before)
+		}
+	}
+	RunMetadata["evidence_files"] = fmt.Sprint(len(paths))
+	RunMetadata["evidence_changed"] = fmt.Sprint(len(changed))
+	return changed
+}
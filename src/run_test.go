@@ -0,0 +1,32 @@
+package src
+
+import "testing"
+
+func TestRecordEvidenceHashes(t *testing.T) {
+	evidenceMutex.Lock()
+	previous := evidenceHashes
+	evidenceHashes = []EvidenceHash{
+		{Path: "/places.sqlite", Size: 10, Before: "aa", After: "aa"},
+		{Path: "/cookies.sqlite", Size: 20, Before: "bb", After: "bb"},
+		{Path: "/places.sqlite", Size: 12, Before: "aa", After: "cc"},
+	}
+	evidenceMutex.Unlock()
+	defer func() { evidenceHashes = previous }()
+
+	changed := RecordEvidenceHashes()
+	if len(changed) != 1 || changed[0] != "/places.sqlite" {
+		t.Errorf("changed %v, expected [/places.sqlite]", changed)
+	}
+
+	expected := map[string]string{
+		"evidence:/places.sqlite":  "size=12 sha256_before=aa sha256_after=cc changed",
+		"evidence:/cookies.sqlite": "size=20 sha256=bb",
+		"evidence_files":           "2",
+		"evidence_changed":         "1",
+	}
+	for key, value := range expected {
+		if RunMetadata[key] != value {
+			t.Errorf("%s = %q, expected %q", key, RunMetadata[key], value)
+		}
+	}
+}
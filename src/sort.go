@@ -0,0 +1,175 @@
+package src
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+/**
+ * External merge sort of artifacts by time.
+ * Artifacts are buffered up to SortBufferSize, each full buffer is sorted and spooled to a temporary file, then
+ * the spooled runs are merged. Artifacts with the same time keep the order they were added in.
+ */
+
+// Number of artifacts sorted in memory before being spooled to disk
+var SortBufferSize = 100000
+
+type Sorter struct {
+	directory string
+	buffer    []BrowserArtifact
+	runs      []string
+	count     int
+}
+
+func NewSorter() (*Sorter, error) {
+	directory, err := os.MkdirTemp("", "BrowserArtifact-sort-")
+	if err != nil {
+		return nil, err
+	}
+	return &Sorter{directory: directory}, nil
+}
+
+func (s *Sorter) Add(artifact BrowserArtifact) error {
+	s.buffer = append(s.buffer, artifact)
+	s.count++
+	if len(s.buffer) >= SortBufferSize {
+		return s.spool()
+	}
+	return nil
+}
+
+func (s *Sorter) Count() int {
+	return s.count
+}
+
+func sortByTime(artifacts []BrowserArtifact) {
+	sort.SliceStable(artifacts, func(i, j int) bool {
+		return artifacts[i].Time.Before(artifacts[j].Time)
+	})
+}
+
+// spool writes the sorted buffer to a new run file
+func (s *Sorter) spool() error {
+	sortByTime(s.buffer)
+
+	path := filepath.Join(s.directory, fmt.Sprintf("run-%06d", len(s.runs)))
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	encoder := gob.NewEncoder(writer)
+	for i := range s.buffer {
+		if err := encoder.Encode(&s.buffer[i]); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	s.runs = append(s.runs, path)
+	s.buffer = nil
+	return nil
+}
+
+// Sort emits the artifacts added so far sorted by time and removes the spooled runs
+func (s *Sorter) Sort(emit Emit) error {
+	defer s.Close()
+
+	// Everything fits in memory
+	if len(s.runs) == 0 {
+		sortByTime(s.buffer)
+		for _, artifact := range s.buffer {
+			emit(artifact)
+		}
+		s.buffer = nil
+		return nil
+	}
+
+	if len(s.buffer) > 0 {
+		if err := s.spool(); err != nil {
+			return err
+		}
+	}
+
+	merge := &runHeap{}
+	for i, path := range s.runs {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		run := &sortRun{index: i, decoder: gob.NewDecoder(bufio.NewReader(file))}
+		if ok, err := run.next(); err != nil {
+			return err
+		} else if ok {
+			heap.Push(merge, run)
+		}
+	}
+
+	for merge.Len() > 0 {
+		run := (*merge)[0]
+		emit(run.current)
+		if ok, err := run.next(); err != nil {
+			return err
+		} else if ok {
+			heap.Fix(merge, 0)
+		} else {
+			heap.Pop(merge)
+		}
+	}
+	return nil
+}
+
+// Close removes the spooled runs
+func (s *Sorter) Close() error {
+	s.buffer = nil
+	s.runs = nil
+	return os.RemoveAll(s.directory)
+}
+
+type sortRun struct {
+	index   int
+	decoder *gob.Decoder
+	current BrowserArtifact
+}
+
+func (r *sortRun) next() (bool, error) {
+	r.current = BrowserArtifact{}
+	err := r.decoder.Decode(&r.current)
+	if err == io.EOF {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// runHeap orders the runs by their current artifact, earlier runs first on equal times
+type runHeap []*sortRun
+
+func (h runHeap) Len() int { return len(h) }
+func (h runHeap) Less(i, j int) bool {
+	if h[i].current.Time.Equal(h[j].current.Time) {
+		return h[i].index < h[j].index
+	}
+	return h[i].current.Time.Before(h[j].current.Time)
+}
+func (h runHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x interface{}) { *h = append(*h, x.(*sortRun)) }
+func (h *runHeap) Pop() interface{} {
+	old := *h
+	run := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return run
+}
@@ -0,0 +1,120 @@
+package src
+
+import (
+	"runtime"
+	"sync"
+)
+
+/**
+ * Artifacts are streamed from the extractors to the exporter instead of being collected in one slice.
+ * Jobs run on Workers goroutines but are emitted in job order from the calling goroutine: the artifacts of the
+ * earliest job are forwarded as the extractor produces them, a later job holds at most jobBuffer artifacts and
+ * waits once it is full. At most a window of jobs is started ahead of the one being emitted.
+ */
+
+// Number of goroutines running extractors
+var Workers = runtime.NumCPU()
+
+// Job is an extractor to run on a profile
+type Job struct {
+	Extractor Extractor
+	Profile   Profile
+}
+
+// Emit receives the artifacts of a stream one at a time
+type Emit func(artifact BrowserArtifact)
+
+// Artifacts of a job buffered while an earlier job is running
+const jobBuffer = 256
+
+// StreamJobs runs the jobs on Workers goroutines and emits their artifacts in the order of the jobs
+func StreamJobs(jobs []Job, emit Emit) {
+	workers := Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	type task struct {
+		job       Job
+		artifacts chan BrowserArtifact
+	}
+
+	// Jobs are started in order, the channels of their artifacts are queued in the same order
+	started := make(chan chan BrowserArtifact, workers*2)
+	tasks := make(chan task)
+	var wait sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for task := range tasks {
+				RunExtractor(task.job.Extractor, task.job.Profile, func(artifact BrowserArtifact) {
+					task.artifacts <- artifact
+				})
+				close(task.artifacts)
+			}
+		}()
+	}
+	go func() {
+		for _, job := range jobs {
+			artifacts := make(chan BrowserArtifact, jobBuffer)
+			started <- artifacts
+			tasks <- task{job: job, artifacts: artifacts}
+		}
+		close(tasks)
+		close(started)
+	}()
+
+	for artifacts := range started {
+		for artifact := range artifacts {
+			emit(artifact)
+		}
+	}
+	wait.Wait()
+}
+
+// StreamParallel calls parse for every index from 0 to n-1 on Workers goroutines and emits the results in index
+// order, used by extractors reading many files. At most a window of results is held ahead of the one being emitted.
+func StreamParallel(n int, parse func(i int) []BrowserArtifact, emit Emit) {
+	workers := Workers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > n {
+		workers = n
+	}
+
+	type task struct {
+		index  int
+		result chan []BrowserArtifact
+	}
+
+	started := make(chan chan []BrowserArtifact, workers*2)
+	tasks := make(chan task)
+	var wait sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for task := range tasks {
+				task.result <- parse(task.index)
+			}
+		}()
+	}
+	go func() {
+		for i := 0; i < n; i++ {
+			result := make(chan []BrowserArtifact, 1)
+			started <- result
+			tasks <- task{index: i, result: result}
+		}
+		close(tasks)
+		close(started)
+	}()
+
+	for result := range started {
+		for _, artifact := range <-result {
+			emit(artifact)
+		}
+	}
+	wait.Wait()
+}
@@ -0,0 +1,125 @@
+package src
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+type testExtractor struct {
+	name    string
+	extract func(emit Emit)
+}
+
+func (e testExtractor) Name() string                     { return e.name }
+func (e testExtractor) Browser() string                  { return "test" }
+func (e testExtractor) ArtifactType() string             { return "test" }
+func (e testExtractor) Locate(profile Profile) []string  { return []string{profile.Path} }
+func (e testExtractor) Sources(profile Profile) []string { return nil }
+func (e testExtractor) Extract(path string, emit Emit)   { e.extract(emit) }
+
+func emitN(name string, n int) func(emit Emit) {
+	return func(emit Emit) {
+		for i := 0; i < n; i++ {
+			emit(BrowserArtifact{Url: fmt.Sprintf("%s/%d", name, i)})
+		}
+	}
+}
+
+func TestStreamJobsOrder(t *testing.T) {
+	previous := Workers
+	Workers = 3
+	defer func() { Workers = previous }()
+
+	counts := []int{3, 3 * jobBuffer, 0, 5, jobBuffer + 1}
+	var jobs []Job
+	var expected []string
+	for i := range counts {
+		name, n := fmt.Sprint("job", i), counts[i]
+		extract := emitN(name, n)
+		if i == 0 {
+			// The first job ends last, the next ones fill their buffer meanwhile
+			extract = func(emit Emit) {
+				time.Sleep(50 * time.Millisecond)
+				emitN(name, n)(emit)
+			}
+		}
+		jobs = append(jobs, Job{Extractor: testExtractor{name: name, extract: extract}, Profile: Profile{User: name}})
+		for j := 0; j < n; j++ {
+			expected = append(expected, fmt.Sprintf("%s/%d", name, j))
+		}
+	}
+
+	var got []BrowserArtifact
+	StreamJobs(jobs, func(artifact BrowserArtifact) {
+		got = append(got, artifact)
+	})
+
+	if len(got) != len(expected) {
+		t.Fatalf("got %d artifacts, expected %d", len(got), len(expected))
+	}
+	for i := range expected {
+		if got[i].Url != expected[i] {
+			t.Fatalf("artifact %d is %s, expected %s", i, got[i].Url, expected[i])
+		}
+		if user := "job" + got[i].Url[3:4]; got[i].User != user {
+			t.Fatalf("artifact %d tagged with %s, expected %s", i, got[i].User, user)
+		}
+	}
+}
+
+func TestStreamJobsForwardsWhileRunning(t *testing.T) {
+	// The extractor waits for its first artifact to reach the exporter before it ends
+	received := make(chan struct{})
+	extract := func(emit Emit) {
+		emit(BrowserArtifact{Url: "first"})
+		select {
+		case <-received:
+		case <-time.After(5 * time.Second):
+			t.Error("first artifact not forwarded while the extractor was running")
+		}
+		emit(BrowserArtifact{Url: "second"})
+	}
+	jobs := []Job{{Extractor: testExtractor{name: "streaming", extract: extract}}}
+
+	count := 0
+	StreamJobs(jobs, func(artifact BrowserArtifact) {
+		count++
+		if count == 1 {
+			close(received)
+		}
+	})
+	if count != 2 {
+		t.Errorf("got %d artifacts, expected 2", count)
+	}
+}
+
+func TestStreamParallelOrder(t *testing.T) {
+	previous := Workers
+	Workers = 4
+	defer func() { Workers = previous }()
+
+	// Earlier files take longer to parse, their results are still emitted first
+	n := 20
+	var got []string
+	StreamParallel(n, func(i int) []BrowserArtifact {
+		time.Sleep(time.Duration(n-i) * time.Millisecond)
+		var artifacts []BrowserArtifact
+		for j := 0; j < i%3; j++ {
+			artifacts = append(artifacts, BrowserArtifact{Url: fmt.Sprintf("%d/%d", i, j)})
+		}
+		return artifacts
+	}, func(artifact BrowserArtifact) {
+		got = append(got, artifact.Url)
+	})
+
+	var expected []string
+	for i := 0; i < n; i++ {
+		for j := 0; j < i%3; j++ {
+			expected = append(expected, fmt.Sprintf("%d/%d", i, j))
+		}
+	}
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("got %v, expected %v", got, expected)
+	}
+}
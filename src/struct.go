@@ -1,5 +1,7 @@
 package src
 
+import "time"
+
 // Struct following CIM Web data model
 type BrowserArtifact struct {
 	ArtifactType    string `json:"artifact_type,omitempty"`
@@ -17,19 +19,48 @@ type BrowserArtifact struct {
 	HttpReferrer    string `json:"http_referrer,omitempty"`
 	HttpUserAgent   string `json:"http_user_agent,omitempty"`
 	HttpContentType string `json:"http_content_type,omitempty"`
+	HttpServer      string `json:"http_server,omitempty"`
 	Duration        int    `json:"duration,omitempty"`
 	Status          string `json:"status,omitempty"`
 	BytesIn         int    `json:"bytes_in,omitempty"`
 	BytesOut        int    `json:"bytes_out,omitempty"`
-	Timestamp       int    `json:"timestamp,omitempty"`
+	Timestamp       int    `json:"timestamp,omitempty"` // Microseconds since 1970-01-01 UTC
 	TimestampType   string `json:"timestamp_type,omitempty"`
 
+	// Time of the artifact, see SetTimestamp
+	Time             time.Time `json:"-"`
+	TimestampRaw     int64     `json:"timestamp_raw,omitempty"`
+	TimestampEpoch   string    `json:"timestamp_epoch,omitempty"`
+	TimestampWarning string    `json:"timestamp_warning,omitempty"`
+
+	// Browser profile the artifact was found in
+	BrowserProfile     string `json:"browser_profile,omitempty"`
+	BrowserProfileName string `json:"browser_profile_name,omitempty"`
+	BrowserAccount     string `json:"browser_account,omitempty"`
+	// Default profile, of the Firefox install BrowserInstall when set
+	BrowserProfileDefault bool   `json:"browser_profile_default,omitempty"`
+	BrowserInstall        string `json:"browser_install,omitempty"`
+
+	// Records recovered from the WAL or journal (wal, wal_superseded, journal) or carved from free space (carved)
+	Recovery   string `json:"recovery,omitempty"`
+	Confidence string `json:"confidence,omitempty"`
+
 	// Additional fields from Firefox
 	Typed         int    `json:"typed,omitempty"`
 	VisitCount    int    `json:"visit_count,omitempty"`
 	Title         string `json:"title,omitempty"`
 	BookmarkTitle string `json:"bookmark_title,omitempty"`
 
+	// Bookmarks additional fields
+	BookmarkFolder string `json:"bookmark_folder,omitempty"`
+	BackupDate     string `json:"backup_date,omitempty"`
+
+	// Session additional fields
+	SessionWindow   int    `json:"session_window,omitempty"`
+	SessionTab      int    `json:"session_tab,omitempty"`
+	NavigationIndex int    `json:"navigation_index,omitempty"`
+	Transition      string `json:"transition,omitempty"`
+
 	// Downloads additional fields
 	Metadata string `json:"metadata,omitempty"`
 	Filename string `json:"filename,omitempty"`
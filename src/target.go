@@ -0,0 +1,163 @@
+package src
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+/**
+ * Target system the artifacts are read from.
+ * By default this is the live system, otherwise RootPath points to a mounted disk image, a triage folder or a zip
+ * and TargetOS tells which layout rules apply to it.
+ * Files of the target are read through the Target* functions: from TargetFS when the target is a zip or a collection
+ * with encoded names (see layout.go), from the host filesystem otherwise.
+ */
+
+var TargetOS = runtime.GOOS
+var RootPath = ""
+
+// TargetFS holds the target system rooted at RootPath, nil when it is read from the host filesystem
+var TargetFS fs.FS
+
+// SetTarget detects the layout of the evidence at root, the target OS is guessed from it when osName is empty
+func SetTarget(root string, osName string) error {
+	RootPath = root
+	TargetFS = nil
+	if osName != "" {
+		TargetOS = osName
+	}
+	if root == "" {
+		return nil
+	}
+
+	layout, err := detectLayout(root)
+	if err != nil {
+		return err
+	}
+	Log.Log("info", "src", "target", "Layout: "+layout.describe())
+	RootPath = layout.root
+	TargetFS = layout.fsys
+	if osName == "" && layout.os != "" {
+		TargetOS = layout.os
+	}
+	return nil
+}
+
+// TargetPath maps an absolute path of the target system onto the host filesystem
+// e.g. TargetPath("Users", "bob") gives C:\Users\bob on a live Windows, /mnt/evidence/Users/bob offline
+func TargetPath(elem ...string) string {
+	root := RootPath
+	if root == "" {
+		root = string(filepath.Separator)
+		if runtime.GOOS == "windows" {
+			root = "C:\\"
+		}
+	}
+	return filepath.Join(append([]string{root}, elem...)...)
+}
+
+// TargetAbsPath maps an absolute path as written on the target system (C:\Users\bob, /home/bob)
+// onto the host filesystem
+func TargetAbsPath(path string) string {
+	if len(path) >= 2 && path[1] == ':' {
+		path = path[2:]
+	}
+	elem := strings.FieldsFunc(path, func(r rune) bool {
+		return r == '\\' || r == '/'
+	})
+	return TargetPath(elem...)
+}
+
+// UsersDirectory returns the directory holding the user homes of the target system
+func UsersDirectory() string {
+	switch TargetOS {
+	case "windows", "darwin":
+		return TargetPath("Users")
+	case "linux":
+		return TargetPath("home")
+	default:
+		return ""
+	}
+}
+
+func UserHome(user string) string {
+	return filepath.Join(UsersDirectory(), user)
+}
+
+// targetName returns the name of a path in TargetFS, false when the path is read from the host filesystem
+func targetName(path string) (string, bool) {
+	if TargetFS == nil {
+		return "", false
+	}
+	relative, err := filepath.Rel(RootPath, path)
+	if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(relative), true
+}
+
+// TargetOpen opens a file of the target, files of a zip are read in memory when they cannot seek
+func TargetOpen(path string) (io.ReadSeekCloser, error) {
+	name, ok := targetName(path)
+	if !ok {
+		return os.Open(path)
+	}
+	file, err := TargetFS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if seeker, ok := file.(io.ReadSeekCloser); ok {
+		return seeker, nil
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	return nopSeekCloser{bytes.NewReader(data)}, nil
+}
+
+type nopSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopSeekCloser) Close() error {
+	return nil
+}
+
+func TargetReadFile(path string) ([]byte, error) {
+	if name, ok := targetName(path); ok {
+		return fs.ReadFile(TargetFS, name)
+	}
+	return os.ReadFile(path)
+}
+
+func TargetReadDir(path string) ([]fs.DirEntry, error) {
+	if name, ok := targetName(path); ok {
+		return fs.ReadDir(TargetFS, name)
+	}
+	return os.ReadDir(path)
+}
+
+func TargetStat(path string) (fs.FileInfo, error) {
+	if name, ok := targetName(path); ok {
+		return fs.Stat(TargetFS, name)
+	}
+	return os.Stat(path)
+}
+
+// TargetWalkDir walks a directory of the target, fn is given the paths as TargetPath returns them
+func TargetWalkDir(path string, fn fs.WalkDirFunc) error {
+	name, ok := targetName(path)
+	if !ok {
+		return filepath.WalkDir(path, fn)
+	}
+	return fs.WalkDir(TargetFS, name, func(file string, entry fs.DirEntry, err error) error {
+		return fn(filepath.Join(RootPath, filepath.FromSlash(file)), entry, err)
+	})
+}
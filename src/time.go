@@ -0,0 +1,100 @@
+package src
+
+import (
+	"encoding/json"
+	"time"
+)
+
+/**
+ * Browsers store times in different epochs and units, the raw value is kept with the epoch it was read in
+ * and converted to a UTC time.Time. Values which cannot be trusted are reported in TimestampWarning.
+ */
+
+const (
+	EpochUnixSeconds      = "unix_seconds"        // Seconds since 1970-01-01
+	EpochUnixMilliseconds = "unix_milliseconds"   // Milliseconds since 1970-01-01 (JavaScript)
+	EpochUnixMicroseconds = "unix_microseconds"   // Microseconds since 1970-01-01 (Firefox PRTime)
+	EpochWebKit           = "webkit_microseconds" // Microseconds since 1601-01-01 (Chromium)
+	EpochCollection       = "collection"          // No time in the source, the time of collection is used
+)
+
+// Microseconds between 1601-01-01 and 1970-01-01
+const webkitOffset = 11644473600000000
+
+// Times before the first web browsers or after the collection are reported
+var (
+	minimumTime   = time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)
+	collectedTime = time.Now().UTC()
+)
+
+// ToTime converts a raw value read in epoch to a UTC time
+func ToTime(raw int64, epoch string) time.Time {
+	switch epoch {
+	case EpochUnixSeconds:
+		return time.Unix(raw, 0).UTC()
+	case EpochUnixMilliseconds:
+		return time.UnixMilli(raw).UTC()
+	case EpochUnixMicroseconds, EpochCollection:
+		return time.UnixMicro(raw).UTC()
+	case EpochWebKit:
+		return time.UnixMicro(raw - webkitOffset).UTC()
+	}
+	return time.Time{}
+}
+
+// IsWebKitTime tells if a value looks like a WebKit time, used to check carved or binary data
+func IsWebKitTime(raw int64) bool {
+	return raw > webkitOffset && raw < webkitOffset*2
+}
+
+// IsPRTime tells if a value looks like a Firefox PRTime between 2000 and 2100, used to check carved data
+func IsPRTime(raw int64) bool {
+	return raw > 946684800000000 && raw < 4102444800000000
+}
+
+// SetTimestamp sets the time of the artifact from a raw value read in epoch
+func (a *BrowserArtifact) SetTimestamp(raw int64, epoch string) {
+	a.TimestampRaw = raw
+	a.TimestampEpoch = epoch
+	a.TimestampWarning = ""
+	a.Time = time.Time{}
+	a.Timestamp = 0
+
+	if raw == 0 {
+		a.TimestampWarning = "not set"
+		return
+	}
+
+	a.Time = ToTime(raw, epoch)
+	a.Timestamp = int(a.Time.UnixMicro())
+	switch {
+	case epoch == EpochCollection:
+		a.TimestampWarning = "no time in the source, time of collection used"
+	case a.Time.Before(minimumTime):
+		a.TimestampWarning = "before 1990, wrong epoch or unit?"
+	case a.Time.After(collectedTime.Add(24 * time.Hour)):
+		a.TimestampWarning = "in the future, wrong epoch or unit?"
+	}
+}
+
+// SetCollectionTime is used for artifacts the source holds no time for
+func (a *BrowserArtifact) SetCollectionTime() {
+	a.SetTimestamp(collectedTime.UnixMicro(), EpochCollection)
+}
+
+// FormatTime writes a time as ISO-8601, empty when the time is unknown
+func FormatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format("2006-01-02T15:04:05.000000Z07:00")
+}
+
+// MarshalJSON writes the time of the artifact as ISO-8601 next to its raw value
+func (a BrowserArtifact) MarshalJSON() ([]byte, error) {
+	type artifact BrowserArtifact
+	return json.Marshal(struct {
+		Time string `json:"time,omitempty"`
+		artifact
+	}{FormatTime(a.Time), artifact(a)})
+}